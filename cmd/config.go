@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"silent_chat/pkg/client"
+	"silent_chat/pkg/config"
+	"silent_chat/pkg/ui"
+)
+
+// settingFlags are the command-line flags that override configuration
+// settings. Only flags given on the command line take effect.
+type settingFlags struct {
+	configPath  *string
+	profile     *string
+	host        *string
+	port        *string
+	username    *string
+	fingerprint *string
+	proxy       *string
+	transport   *string
+	theme       *string
+}
+
+func registerSettingFlags(flagSet *flag.FlagSet) settingFlags {
+	return settingFlags{
+		configPath:  flagSet.String("config", "", "configuration file (default $XDG_CONFIG_HOME/silent_chat/config.toml)"),
+		profile:     flagSet.String("profile", "", "server profile from the configuration file"),
+		host:        flagSet.String("host", "", "server host"),
+		port:        flagSet.String("port", "", "server port"),
+		username:    flagSet.String("user", "", "username"),
+		fingerprint: flagSet.String("fingerprint", "", "expected SHA-256 fingerprint of the server certificate"),
+		proxy:       flagSet.String("proxy", "", "proxy URL: socks5://, socks5h:// or http://"),
+		transport:   flagSet.String("transport", "", `"tls" or "websocket"`),
+		theme:       flagSet.String("theme", "", "color theme: "+strings.Join(ui.Themes(), ", ")),
+	}
+}
+
+// registerProfileFlags registers only the flags that select the
+// configuration file and profile, for commands that do not connect.
+func registerProfileFlags(flagSet *flag.FlagSet) settingFlags {
+	return settingFlags{
+		configPath: flagSet.String("config", "", "configuration file (default $XDG_CONFIG_HOME/silent_chat/config.toml)"),
+		profile:    flagSet.String("profile", "", "server profile from the configuration file"),
+	}
+}
+
+// configFilePath returns the configuration file selected by --config or
+// CHAT_CONFIG, or the default location. explicit reports whether the file
+// was named by the user and therefore must exist.
+func configFilePath(flags settingFlags) (path string, explicit bool, err error) {
+	if *flags.configPath != "" {
+		return *flags.configPath, true, nil
+	}
+	if path := os.Getenv("CHAT_CONFIG"); path != "" {
+		return path, true, nil
+	}
+	path, err = config.DefaultFilePath()
+	return path, false, err
+}
+
+// loadConfig builds the configuration from, in increasing precedence, the
+// defaults, the selected profile of the configuration file, the CHAT_*
+// environment variables and the flags set on the command line.
+func loadConfig(flagSet *flag.FlagSet, flags settingFlags) (*config.Config, error) {
+	cfg := config.NewConfig()
+
+	path, explicit, err := configFilePath(flags)
+	if err != nil {
+		return nil, err
+	}
+	file, err := config.LoadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !explicit:
+		file = &config.File{}
+	case err != nil:
+		return nil, err
+	}
+	// The file names the user and their servers, so the panic wipe
+	// deletes it.
+	cfg.WipePaths = append(cfg.WipePaths, path)
+
+	name := *flags.profile
+	if name == "" {
+		name = os.Getenv("CHAT_PROFILE")
+	}
+	if profile, ok, err := file.Profile(name); err != nil {
+		return nil, err
+	} else if ok {
+		profile.Apply(cfg)
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	var flagErr error
+	flagSet.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			cfg.Host = *flags.host
+		case "port":
+			cfg.Port = *flags.port
+		case "user":
+			cfg.Username = *flags.username
+		case "fingerprint":
+			fp, err := config.NormalizeFingerprint(*flags.fingerprint)
+			if err != nil {
+				flagErr = fmt.Errorf("--fingerprint: %v", err)
+				return
+			}
+			cfg.ExpectedFP, cfg.BackupFPs = fp, nil
+		case "proxy":
+			cfg.Proxy = *flags.proxy
+		case "transport":
+			cfg.Transport = *flags.transport
+		case "theme":
+			cfg.Theme = *flags.theme
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := checkSettings(cfg); err != nil {
+		return nil, err
+	}
+	if err := ui.SetTheme(cfg.Theme); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// checkSettings reports settings that would only fail once the client
+// connects or starts drawing.
+func checkSettings(cfg *config.Config) error {
+	if _, err := client.NewTransport(cfg); err != nil {
+		return fmt.Errorf("invalid connection settings: %v", err)
+	}
+	if cfg.Theme != "" && !slices.Contains(ui.Themes(), cfg.Theme) {
+		return fmt.Errorf("unknown theme %q (available: %s)", cfg.Theme, strings.Join(ui.Themes(), ", "))
+	}
+	return nil
+}
+
+// applyEnv overrides cfg with the CHAT_* environment variables that are set.
+func applyEnv(cfg *config.Config) error {
+	if fp := os.Getenv("CHAT_SERVER_FINGERPRINT"); fp != "" {
+		normalized, err := config.NormalizeFingerprint(fp)
+		if err != nil {
+			return fmt.Errorf("CHAT_SERVER_FINGERPRINT: %v", err)
+		}
+		cfg.ExpectedFP, cfg.BackupFPs = normalized, nil
+	}
+	if path := os.Getenv("CHAT_HISTORY_FILE"); path != "" {
+		cfg.HistoryPath = path
+	}
+	if path := os.Getenv("CHAT_OUTBOX_FILE"); path != "" {
+		cfg.OutboxPath = path
+	}
+	if transport := os.Getenv("CHAT_TRANSPORT"); transport != "" {
+		cfg.Transport = transport
+	}
+	if endpoints := os.Getenv("CHAT_SERVER_ENDPOINTS"); endpoints != "" {
+		cfg.Endpoints = strings.Split(endpoints, ",")
+	}
+	if proxy := os.Getenv("CHAT_PROXY"); proxy != "" {
+		cfg.Proxy = proxy
+	}
+	if isolation := os.Getenv("CHAT_PROXY_ISOLATION"); isolation != "" {
+		on, err := strconv.ParseBool(isolation)
+		if err != nil {
+			return fmt.Errorf("CHAT_PROXY_ISOLATION: %v", err)
+		}
+		cfg.ProxyIsolation = on
+	}
+	if theme := os.Getenv("CHAT_THEME"); theme != "" {
+		cfg.Theme = theme
+	}
+	return nil
+}
+
+// runConfig checks the configuration file or shows where it is and what it
+// resolves to.
+func runConfig(c *cli, flagSet *flag.FlagSet, args []string) error {
+	action, args := splitAction(args)
+	flags := registerSettingFlags(flagSet)
+	if err := parseFlags(flagSet, args); err != nil {
+		return err
+	}
+	if flagSet.NArg() > 0 {
+		return usagef("unexpected argument %q", flagSet.Arg(0))
+	}
+
+	switch action {
+	case "", "validate":
+		return validateConfig(c, flagSet, flags)
+	case "show":
+		cfg, err := loadConfig(flagSet, flags)
+		if err != nil {
+			return err
+		}
+		printSettings(c.stdout, cfg)
+		return nil
+	case "path":
+		path, _, err := configFilePath(flags)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.stdout, path)
+		return nil
+	default:
+		return usagef("unknown action %q", action)
+	}
+}
+
+// validateConfig checks every profile of the configuration file, not only
+// the selected one, and then the settings the selected profile resolves to.
+func validateConfig(c *cli, flagSet *flag.FlagSet, flags settingFlags) error {
+	path, explicit, err := configFilePath(flags)
+	if err != nil {
+		return err
+	}
+	file, err := config.LoadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !explicit:
+		fmt.Fprintf(c.stdout, "No configuration file at %s; using the built-in defaults.\n", path)
+		file = &config.File{}
+	case err != nil:
+		return err
+	}
+	for _, name := range file.ProfileNames() {
+		cfg := config.NewConfig()
+		file.Profiles[name].Apply(cfg)
+		if err := checkSettings(cfg); err != nil {
+			return fmt.Errorf("config file %s: profile %q: %v", path, name, err)
+		}
+	}
+	if _, err := loadConfig(flagSet, flags); err != nil {
+		return err
+	}
+	if len(file.Profiles) > 0 {
+		fmt.Fprintf(c.stdout, "%s: OK (profiles: %s)\n", path, strings.Join(file.ProfileNames(), ", "))
+	} else {
+		fmt.Fprintln(c.stdout, "Settings OK.")
+	}
+	return nil
+}
+
+// printSettings writes the effective settings, one per line.
+func printSettings(w io.Writer, cfg *config.Config) {
+	pins := []string{}
+	if cfg.ExpectedFP != "" {
+		pins = append([]string{cfg.ExpectedFP}, cfg.BackupFPs...)
+	}
+	isolation := "off"
+	if cfg.ProxyIsolation {
+		isolation = "on"
+	}
+	settings := []struct{ name, value string }{
+		{"host", cfg.Host},
+		{"port", cfg.Port},
+		{"username", cfg.Username},
+		{"fingerprints", strings.Join(pins, ", ")},
+		{"endpoints", strings.Join(cfg.Endpoints, ", ")},
+		{"transport", cfg.Transport},
+		{"websocket_path", cfg.WebSocketPath},
+		{"proxy", cfg.Proxy},
+		{"proxy_isolation", isolation},
+		{"dial_timeout", cfg.DialTimeout.String()},
+		{"auth_timeout", cfg.AuthTimeout.String()},
+		{"read_timeout", cfg.ReadTimeout.String()},
+		{"history_file", cfg.HistoryPath},
+		{"outbox_file", cfg.OutboxPath},
+		{"theme", cfg.Theme},
+		{"contacts", strings.Join(cfg.Contacts, ", ")},
+	}
+	for _, s := range settings {
+		fmt.Fprintf(w, "%-16s %s\n", s.name, s.value)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	fileFP := strings.Repeat("a", 64)
+	envFP := strings.Repeat("b", 64)
+	flagFP := strings.Repeat("c", 64)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	err := os.WriteFile(path, []byte(`
+default_profile = "home"
+
+[profiles.home]
+host = "home.example"
+
+[profiles.work]
+host = "work.example"
+port = 4000
+username = "alice"
+fingerprints = ["`+fileFP+`"]
+transport = "websocket"
+theme = "light"
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"CHAT_CONFIG", "CHAT_PROFILE", "CHAT_SERVER_FINGERPRINT", "CHAT_TRANSPORT", "CHAT_THEME", "CHAT_PROXY"} {
+		t.Setenv(name, "")
+	}
+
+	load := func(args ...string) (host, port, user, fp, transport, theme string) {
+		t.Helper()
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		flags := registerSettingFlags(fs)
+		if err := fs.Parse(append([]string{"--config", path}, args...)); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := loadConfig(fs, flags)
+		if err != nil {
+			t.Fatalf("loadConfig(%v) error = %v", args, err)
+		}
+		return cfg.Host, cfg.Port, cfg.Username, cfg.ExpectedFP, cfg.Transport, cfg.Theme
+	}
+
+	if host, _, _, _, transport, _ := load(); host != "home.example" || transport != "tls" {
+		t.Errorf("default profile: host %q, transport %q", host, transport)
+	}
+
+	host, port, user, fp, transport, theme := load("--profile", "work")
+	if host != "work.example" || port != "4000" || user != "alice" || fp != fileFP || transport != "websocket" || theme != "light" {
+		t.Errorf("file: %s %s %s %s %s %s", host, port, user, fp, transport, theme)
+	}
+
+	t.Setenv("CHAT_SERVER_FINGERPRINT", envFP)
+	t.Setenv("CHAT_TRANSPORT", "tls")
+	if _, _, _, fp, transport, _ := load("--profile", "work"); fp != envFP || transport != "tls" {
+		t.Errorf("env over file: fingerprint %q, transport %q", fp, transport)
+	}
+
+	_, _, user, fp, transport, _ = load("--profile", "work", "--fingerprint", flagFP, "--transport", "websocket", "--user", "bob")
+	if fp != flagFP || transport != "websocket" || user != "bob" {
+		t.Errorf("flags over env: fingerprint %q, transport %q, user %q", fp, transport, user)
+	}
+
+	t.Setenv("CHAT_PROFILE", "work")
+	if host, _, _, _, _, _ := load(); host != "work.example" {
+		t.Errorf("CHAT_PROFILE: host %q", host)
+	}
+}
+
+func TestLoadConfigWipesConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[profiles.home]\nhost = \"home.example\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CHAT_PROFILE", "")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flags := registerSettingFlags(fs)
+	if err := fs.Parse([]string{"--config", path}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(fs, flags)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if !slices.Contains(cfg.WipePaths, path) {
+		t.Errorf("WipePaths = %v, want it to contain %q", cfg.WipePaths, path)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	t.Setenv("CHAT_CONFIG", "")
+	t.Setenv("CHAT_PROFILE", "")
+	t.Setenv("CHAT_SERVER_FINGERPRINT", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	tests := [][]string{
+		{"--config", filepath.Join(t.TempDir(), "missing.toml")},
+		{"--profile", "work"},
+		{"--fingerprint", "abc"},
+		{"--transport", "carrier-pigeon"},
+		{"--theme", "neon"},
+	}
+	for _, args := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags := registerSettingFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(fs, flags); err == nil {
+			t.Errorf("loadConfig(%v) succeeded", args)
+		}
+	}
+
+	// Without --config, a missing default file is fine.
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := registerSettingFlags(fs)
+	if _, err := loadConfig(fs, flags); err != nil {
+		t.Errorf("loadConfig() without a config file error = %v", err)
+	}
+}
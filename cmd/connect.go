@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/signal"
+	"syscall"
+
+	"silent_chat/pkg/client"
+	"silent_chat/pkg/history"
+	"silent_chat/pkg/identity"
+	"silent_chat/pkg/logging"
+	"silent_chat/pkg/tui"
+)
+
+const clearScreen = "\033[2J\033[H"
+
+// runConnect opens the chat. It is the default command.
+func runConnect(c *cli, fs *flag.FlagSet, args []string) error {
+	debug := fs.Bool("debug", false, "write debug-level records to the log file")
+	logPath := fs.String("log", "", "log file (default $XDG_STATE_HOME/silent_chat/client.log)")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this loopback address, e.g. 127.0.0.1:9464")
+	settings := registerSettingFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+
+	fmt.Fprint(c.stdout, clearScreen)
+
+	level := slog.LevelInfo
+	if *debug {
+		level = slog.LevelDebug
+	}
+	logger, logFile, err := logging.New(logging.Options{Path: *logPath, Level: level})
+	if err != nil {
+		// The terminal belongs to the TUI, so never fall back to stderr.
+		fmt.Fprintf(c.stdout, "Logging disabled: %v\n", err)
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	} else {
+		defer logFile.Close()
+	}
+	slog.SetDefault(logger)
+
+	config, err := loadConfig(fs, settings)
+	if err != nil {
+		return fmt.Errorf("configuration error: %v", err)
+	}
+	// The panic wipe deletes the identity key and the log, which names the
+	// user and the servers, along with the history and the configuration
+	// file.
+	if path, err := identity.DefaultPath(); err == nil {
+		config.WipePaths = append(config.WipePaths, path)
+	}
+	if logFile != nil {
+		config.WipePaths = append(config.WipePaths, logFile.Files()...)
+	}
+
+	if config.ExpectedFP == "" {
+		fmt.Fprintln(c.stdout, "\nWARNING: no server fingerprint is pinned.")
+		fmt.Fprintln(c.stdout, `Run "silent_chat fingerprint <host:port>", compare the result out of band, then set CHAT_SERVER_FINGERPRINT or add it to your profile`)
+	} else {
+		fmt.Fprintf(c.stdout, "\nSecure mode enabled.\nExpected server fingerprint: %s\n\n", config.ExpectedFP)
+	}
+
+	var store *history.Store
+	if config.HistoryPath != "" {
+		store, err = c.openHistory(config.HistoryPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := store.Close(); err != nil {
+				slog.Error("history close", "err", err)
+			}
+		}()
+	}
+
+	outbox, err := c.openOutbox(config.OutboxPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	metrics := client.NewMetrics()
+	if *metricsAddr != "" {
+		srv, err := client.ListenMetrics(*metricsAddr, metrics)
+		if err != nil {
+			return fmt.Errorf("failed to start metrics endpoint: %v", err)
+		}
+		defer srv.Close()
+	}
+
+	chat := &tui.Client{
+		Config:  config,
+		History: store,
+		Outbox:  outbox,
+		Metrics: metrics,
+	}
+
+	err = chat.Run(ctx)
+	if ctx.Err() != nil {
+		fmt.Fprintln(c.stdout, "\nSignal received. Chat closed.")
+	}
+	if err != nil {
+		return fmt.Errorf("client terminated: %v", err)
+	}
+	return nil
+}
+
+// openHistory asks for the passphrase and opens the history at path.
+func (c *cli) openHistory(path string) (*history.Store, error) {
+	passphrase, err := c.readPassphrase("History passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	store, err := history.Open(path, passphrase)
+	wipe(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %v", err)
+	}
+	return store, nil
+}
+
+// openOutbox opens the outbox at path, asking for its passphrase. An empty
+// path keeps the outbox in memory and asks for nothing.
+func (c *cli) openOutbox(path string) (*client.Outbox, error) {
+	var passphrase []byte
+	if path != "" {
+		var err error
+		if passphrase, err = c.readPassphrase("Outbox passphrase: "); err != nil {
+			return nil, err
+		}
+	}
+	outbox, err := client.NewOutbox(path, passphrase)
+	wipe(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox: %v", err)
+	}
+	return outbox, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"silent_chat/pkg/client"
+	"silent_chat/pkg/protocol"
+)
+
+// runFingerprint fetches the certificate of a server without checking it
+// and prints its fingerprint in the formats users compare out of band. If
+// a fingerprint is pinned in the configuration, it also reports whether the
+// certificate matches it and fails if not.
+func runFingerprint(c *cli, fs *flag.FlagSet, args []string) error {
+	settings := registerSettingFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return usagef("unexpected argument %q", fs.Arg(1))
+	}
+	cfg, err := loadConfig(fs, settings)
+	if err != nil {
+		return err
+	}
+
+	var endpoint client.Endpoint
+	switch {
+	case fs.NArg() == 1:
+		if endpoint, err = client.ParseEndpoint(fs.Arg(0), cfg.Port); err != nil {
+			return usageError{msg: err.Error()}
+		}
+	case cfg.Host != "":
+		if endpoint, err = client.ParseEndpoint(cfg.Host, cfg.Port); err != nil {
+			return err
+		}
+	default:
+		return usagef("no server given and none configured")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cert, err := client.FetchCertificate(ctx, client.Options{Config: cfg}, endpoint)
+	if err != nil {
+		return err
+	}
+
+	fp := protocol.CertFingerprint(cert)
+	fmt.Fprintf(c.stdout, "Server:  %s\n", endpoint)
+	fmt.Fprintf(c.stdout, "Subject: %s\n", cert.Subject)
+	fmt.Fprintf(c.stdout, "Expires: %s\n", cert.NotAfter.Format("2006-01-02"))
+	fmt.Fprintf(c.stdout, "SHA-256: %s\n", fp)
+	fmt.Fprintf(c.stdout, "Colon:   %s\n", protocol.FormatFingerprint(fp))
+	fmt.Fprintf(c.stdout, "SPKI:    %s\n", protocol.SPKIFingerprint(cert))
+
+	if cfg.ExpectedFP == "" {
+		return nil
+	}
+	if fp != cfg.ExpectedFP && !slices.Contains(cfg.BackupFPs, fp) {
+		return fmt.Errorf("%w: the certificate does not match the pinned fingerprint %s", client.ErrFingerprintMismatch, cfg.ExpectedFP)
+	}
+	fmt.Fprintln(c.stdout, "Matches the pinned fingerprint.")
+	return nil
+}
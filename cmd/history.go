@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"silent_chat/pkg/history"
+	"silent_chat/pkg/ui"
+)
+
+// runHistory searches or exports the encrypted message history. The
+// passphrase is read from the terminal, or from the first line of stdin
+// when it is not a terminal.
+func runHistory(c *cli, fs *flag.FlagSet, args []string) error {
+	action, args := splitAction(args)
+	file := fs.String("file", "", "history file (default: history_file of the profile or CHAT_HISTORY_FILE)")
+	format := fs.String("format", "text", `output format: "text" or "json"`)
+	output := fs.String("output", "", "write to this file instead of stdout")
+	settings := registerProfileFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var query string
+	switch action {
+	case "search":
+		if fs.NArg() != 1 {
+			return usagef("search needs exactly one query")
+		}
+		query = fs.Arg(0)
+	case "export", "duress":
+		if fs.NArg() > 0 {
+			return usagef("unexpected argument %q", fs.Arg(0))
+		}
+	case "":
+		return usagef("missing action")
+	default:
+		return usagef("unknown action %q", action)
+	}
+	if *format != "text" && *format != "json" {
+		return usagef("unknown format %q", *format)
+	}
+
+	path := *file
+	if path == "" {
+		cfg, err := loadConfig(fs, settings)
+		if err != nil {
+			return err
+		}
+		path = cfg.HistoryPath
+	}
+	if path == "" {
+		return usagef("no history file given and none configured")
+	}
+	if _, err := os.Stat(path); err != nil {
+		// history.Open would create a new, empty store.
+		return fmt.Errorf("failed to open history: %v", err)
+	}
+
+	store, err := c.openHistory(path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if action == "duress" {
+		return c.setDuress(store)
+	}
+
+	entries := store.Entries()
+	if action == "search" {
+		entries = store.Search(query)
+	}
+
+	if *output == "" {
+		return writeEntries(c.stdout, entries, *format)
+	}
+	// The export is not encrypted, so keep it private like the history.
+	f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := writeEntries(f, entries, *format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// setDuress asks for a duress passphrase and stores it in the history.
+// Entering it instead of the real passphrase opens an empty decoy profile.
+func (c *cli) setDuress(store *history.Store) error {
+	duress, err := c.readPassphrase("New duress passphrase: ")
+	if err != nil {
+		return err
+	}
+	defer wipe(duress)
+	if len(duress) == 0 {
+		return fmt.Errorf("the duress passphrase must not be empty")
+	}
+	if err := store.SetDuressPassphrase(duress); err != nil {
+		return fmt.Errorf("failed to set duress passphrase: %v", err)
+	}
+	fmt.Fprintln(c.stdout, "Duress passphrase set.")
+	return nil
+}
+
+// writeEntries writes entries as "time sender: text" lines or as a JSON array.
+// Senders and texts come from the network, so the text format escapes
+// control characters before they reach the terminal; JSON keeps them as
+// they are.
+func writeEntries(w io.Writer, entries []history.Entry, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if entries == nil {
+			entries = []history.Entry{}
+		}
+		return enc.Encode(entries)
+	}
+	for _, e := range entries {
+		stamp := time.Unix(e.Time, 0).Format("2006-01-02 15:04:05")
+		sender, _ := ui.Sanitize(e.Sender)
+		text, _ := ui.Sanitize(e.Text)
+		if _, err := fmt.Fprintf(w, "%s %s: %s\n", stamp, sender, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
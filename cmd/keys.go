@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"silent_chat/pkg/identity"
+)
+
+// runKeys generates, shows or deletes the identity key.
+func runKeys(c *cli, fs *flag.FlagSet, args []string) error {
+	action, args := splitAction(args)
+	file := fs.String("file", "", "key file (default $XDG_DATA_HOME/silent_chat/identity.pem)")
+	yes := fs.Bool("yes", false, "delete without asking for confirmation")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+
+	path := *file
+	if path == "" {
+		var err error
+		if path, err = identity.DefaultPath(); err != nil {
+			return err
+		}
+	}
+
+	switch action {
+	case "generate":
+		passphrase, err := c.readPassphrase("New key passphrase: ")
+		if err != nil {
+			return err
+		}
+		defer wipe(passphrase)
+		if len(passphrase) == 0 {
+			return fmt.Errorf("the key passphrase must not be empty")
+		}
+		key, err := identity.Generate()
+		if err != nil {
+			return err
+		}
+		if err := identity.Save(path, key, passphrase); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.stdout, "Identity key written to %s\n", path)
+		printKey(c, key)
+		return nil
+	case "show":
+		// Only ask for the passphrase if there is a key to decrypt.
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w at %s", identity.ErrNoKey, path)
+		}
+		passphrase, err := c.readPassphrase("Key passphrase: ")
+		if err != nil {
+			return err
+		}
+		key, err := identity.Load(path, passphrase)
+		wipe(passphrase)
+		if err != nil {
+			return err
+		}
+		printKey(c, key)
+		return nil
+	case "delete":
+		if !*yes {
+			return usagef("deleting the identity key cannot be undone; pass --yes to confirm")
+		}
+		if err := identity.Delete(path); err != nil {
+			return fmt.Errorf("failed to delete identity key: %v", err)
+		}
+		fmt.Fprintf(c.stdout, "Identity key %s deleted.\n", path)
+		return nil
+	case "":
+		return usagef("missing action")
+	default:
+		return usagef("unknown action %q", action)
+	}
+}
+
+func printKey(c *cli, key identity.Key) {
+	fmt.Fprintf(c.stdout, "Public key:  %s\n", base64.StdEncoding.EncodeToString(key.Public()))
+	fmt.Fprintf(c.stdout, "Fingerprint: %s\n", key.Fingerprint())
+}
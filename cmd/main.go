@@ -1,52 +1,227 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
 
-	"silent_chat/pkg/client"
-	"silent_chat/pkg/config"
+	"golang.org/x/term"
 )
 
-const clearScreen = "\033[2J\033[H"
+// Exit codes shared by all commands.
+const (
+	exitOK    = 0 // success, including --help
+	exitError = 1 // the command failed
+	exitUsage = 2 // invalid command line
+)
+
+// command is a subcommand of the silent_chat binary.
+type command struct {
+	name    string
+	args    string // synopsis of the arguments after the flags
+	summary string
+	// run registers its flags on fs, parses args with parseFlags and
+	// executes the command.
+	run func(c *cli, fs *flag.FlagSet, args []string) error
+}
+
+// commands returns the subcommands in the order they are listed in the
+// usage. The first one is run when no command is given.
+func commands() []command {
+	return []command{
+		{name: "connect", args: "[flags]", summary: "connect to a server and open the chat (default)", run: runConnect},
+		{name: "fingerprint", args: "[flags] [host:port]", summary: "fetch and print the certificate fingerprint of a server", run: runFingerprint},
+		{name: "keys", args: "generate|show|delete [flags]", summary: "manage the identity key", run: runKeys},
+		{name: "history", args: "search <query>|export|duress [flags]", summary: "search or export the encrypted message history, or set its duress passphrase", run: runHistory},
+		{name: "config", args: "validate|show|path [flags]", summary: "check the configuration file and show the effective settings", run: runConfig},
+		{name: "version", args: "", summary: "print the build and protocol version", run: runVersion},
+	}
+}
+
+// usageError reports an invalid command line. It makes the command exit
+// with exitUsage after printing its usage.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string { return e.msg }
+
+// usagef returns a usageError with a formatted message.
+func usagef(format string, args ...any) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// parseFlags parses the flags of a command. Parse errors are returned as
+// usage errors; -h and --help return flag.ErrHelp.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return usageError{msg: err.Error()}
+}
+
+// splitAction separates the action of a command with actions, such as
+// "generate" in "keys generate", from the remaining arguments. If args
+// start with a flag, the action is empty.
+func splitAction(args []string) (string, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", args
+	}
+	return args[0], args[1:]
+}
+
+// cli holds the standard streams of a run, so that tests can replace them.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	lines *bufio.Reader // reads passphrases when stdin is not a terminal
+}
+
+func newCLI() *cli {
+	return &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+}
 
 func main() {
-	fmt.Print(clearScreen)
+	os.Exit(newCLI().run(os.Args[1:]))
+}
 
-	config := config.NewConfig()
-	config.ExpectedFP = os.Getenv("CHAT_SERVER_FINGERPRINT")
+// run executes the command named by args[0] and returns the exit code.
+// Without a command, or if args start with a flag, it runs connect.
+func (c *cli) run(args []string) int {
+	cmds := commands()
+	cmd := cmds[0]
+	if len(args) > 0 {
+		switch name := args[0]; {
+		case name == "help":
+			return c.help(args[1:])
+		case name == "-h" || name == "-help" || name == "--help":
+			c.printUsage(c.stdout)
+			return exitOK
+		case !strings.HasPrefix(name, "-"):
+			found, ok := lookupCommand(name)
+			if !ok {
+				fmt.Fprintf(c.stderr, "silent_chat: unknown command %q\n\n", name)
+				c.printUsage(c.stderr)
+				return exitUsage
+			}
+			cmd, args = found, args[1:]
+		}
+	}
 
-	if config.ExpectedFP == "" {
-		fmt.Println("\nWARNING: CHAT_SERVER_FINGERPRINT is not set.")
-		fmt.Println("Please set env and try again")
-	} else {
-		fmt.Printf("\nSecure mode enabled.\nExpected server fingerprint: %s\n\n", config.ExpectedFP)
+	fs := newFlagSet(cmd)
+	err := cmd.run(c, fs, args)
+	var usageErr usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		c.printCommandUsage(c.stdout, cmd, fs)
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(c.stderr, "silent_chat %s: %v\n\n", cmd.name, err)
+		c.printCommandUsage(c.stderr, cmd, fs)
+		return exitUsage
+	default:
+		fmt.Fprintf(c.stderr, "silent_chat %s: %v\n", cmd.name, err)
+		return exitError
 	}
+}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT)
+// help prints the usage of the program or of the named command.
+func (c *cli) help(args []string) int {
+	if len(args) == 0 {
+		c.printUsage(c.stdout)
+		return exitOK
+	}
+	cmd, ok := lookupCommand(args[0])
+	if !ok {
+		fmt.Fprintf(c.stderr, "silent_chat help: unknown command %q\n", args[0])
+		return exitUsage
+	}
+	fs := newFlagSet(cmd)
+	// Running the command with --help registers its flags and returns
+	// flag.ErrHelp before it does anything else.
+	cmd.run(c, fs, []string{"--help"})
+	c.printCommandUsage(c.stdout, cmd, fs)
+	return exitOK
+}
 
-	client := &client.Client{
-		Config:    config,
-		Connected: false,
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd, true
+		}
 	}
+	return command{}, false
+}
 
-	go func() {
-		<-sigChan
-		fmt.Println("\nCtrl+C pressed. Closing chat...")
-		if client.Conn != nil {
-			if errClose := client.Conn.Close(); errClose != nil {
-				log.Printf("client close err: %v", errClose)
-			}
+// newFlagSet returns the flag set of cmd. Errors and usage are printed by
+// run, so the flag set itself stays silent.
+func newFlagSet(cmd command) *flag.FlagSet {
+	fs := flag.NewFlagSet("silent_chat "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func (c *cli) printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: silent_chat [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "silent_chat help <command>" for the flags of a command.`)
+}
+
+func (c *cli) printCommandUsage(w io.Writer, cmd command, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: %s\n\n", strings.TrimSpace("silent_chat "+cmd.name+" "+cmd.args))
+	fmt.Fprintf(w, "%s%s.\n", strings.ToUpper(cmd.summary[:1]), cmd.summary[1:])
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Flags:")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+		fs.SetOutput(io.Discard)
+	}
+}
+
+// readPassphrase prompts on stderr and reads a passphrase without echo. If
+// stdin is not a terminal, for example in scripts, it reads one line.
+func (c *cli) readPassphrase(prompt string) ([]byte, error) {
+	fmt.Fprint(c.stderr, prompt)
+	if f, ok := c.stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		passphrase, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(c.stderr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %v", err)
 		}
-		os.Exit(0)
-	}()
+		return passphrase, nil
+	}
+
+	if c.lines == nil {
+		c.lines = bufio.NewReader(c.stdin)
+	}
+	line, err := c.lines.ReadBytes('\n')
+	fmt.Fprintln(c.stderr)
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, fmt.Errorf("failed to read passphrase: %v", err)
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
 
-	if err := client.Run(); err != nil {
-		fmt.Printf("Client terminated: %v\n", err)
-		os.Exit(1)
+func wipe(secret []byte) {
+	for i := range secret {
+		secret[i] = 0
 	}
 }
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"silent_chat/pkg/history"
+	"silent_chat/pkg/protocol"
+)
+
+// runCLI runs the command line args with stdin and returns the exit code
+// and the output.
+func runCLI(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	c := &cli{stdin: strings.NewReader(stdin), stdout: &out, stderr: &errOut}
+	code = c.run(args)
+	return code, out.String(), errOut.String()
+}
+
+// isolateEnv points the configuration and data directories at an empty
+// temporary directory and clears the CHAT_* variables.
+func isolateEnv(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("XDG_DATA_HOME", dir)
+	for _, name := range []string{"CHAT_CONFIG", "CHAT_PROFILE", "CHAT_SERVER_FINGERPRINT", "CHAT_HISTORY_FILE", "CHAT_TRANSPORT", "CHAT_PROXY", "CHAT_THEME"} {
+		t.Setenv(name, "")
+	}
+	return dir
+}
+
+func TestCLIExitCodes(t *testing.T) {
+	isolateEnv(t)
+	tests := []struct {
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{args: []string{"version"}, wantCode: exitOK, wantStdout: "protocol version 1"},
+		{args: []string{"--help"}, wantCode: exitOK, wantStdout: "Commands:"},
+		{args: []string{"help"}, wantCode: exitOK, wantStdout: "fingerprint"},
+		{args: []string{"help", "keys"}, wantCode: exitOK, wantStdout: "-file"},
+		{args: []string{"help", "nope"}, wantCode: exitUsage, wantStderr: "unknown command"},
+		{args: []string{"nope"}, wantCode: exitUsage, wantStderr: `unknown command "nope"`},
+		{args: []string{"connect", "--help"}, wantCode: exitOK, wantStdout: "-metrics-addr"},
+		{args: []string{"-h"}, wantCode: exitOK, wantStdout: "Usage: silent_chat [command]"},
+		{args: []string{"--no-such-flag"}, wantCode: exitUsage, wantStderr: "Usage: silent_chat connect"},
+		{args: []string{"fingerprint", "-h"}, wantCode: exitOK, wantStdout: "Usage: silent_chat fingerprint"},
+		{args: []string{"fingerprint"}, wantCode: exitUsage, wantStderr: "no server given"},
+		{args: []string{"fingerprint", "a:1", "b:2"}, wantCode: exitUsage, wantStderr: "unexpected argument"},
+		{args: []string{"keys"}, wantCode: exitUsage, wantStderr: "missing action"},
+		{args: []string{"keys", "rotate"}, wantCode: exitUsage, wantStderr: `unknown action "rotate"`},
+		{args: []string{"keys", "show"}, wantCode: exitError, wantStderr: "no identity key"},
+		{args: []string{"keys", "delete"}, wantCode: exitUsage, wantStderr: "--yes"},
+		{args: []string{"history", "export"}, wantCode: exitUsage, wantStderr: "no history file"},
+		{args: []string{"history", "search"}, wantCode: exitUsage, wantStderr: "exactly one query"},
+		{args: []string{"history", "export", "--format", "xml", "--file", "x"}, wantCode: exitUsage, wantStderr: "unknown format"},
+		{args: []string{"config"}, wantCode: exitOK, wantStdout: "built-in defaults"},
+		{args: []string{"config", "validate", "--config", "/nonexistent/config.toml"}, wantCode: exitError, wantStderr: "/nonexistent/config.toml"},
+		{args: []string{"config", "validate", "--theme", "neon"}, wantCode: exitError, wantStderr: "unknown theme"},
+		{args: []string{"config", "show", "--host", "chat.example"}, wantCode: exitOK, wantStdout: "chat.example"},
+		{args: []string{"version", "extra"}, wantCode: exitUsage, wantStderr: "unexpected argument"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			code, stdout, stderr := runCLI(t, "", tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d\nstdout: %s\nstderr: %s", code, tt.wantCode, stdout, stderr)
+			}
+			if !strings.Contains(stdout, tt.wantStdout) {
+				t.Errorf("stdout = %q, want it to contain %q", stdout, tt.wantStdout)
+			}
+			if !strings.Contains(stderr, tt.wantStderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr, tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestConfigValidateChecksAllProfiles(t *testing.T) {
+	dir := isolateEnv(t)
+	path := filepath.Join(dir, "config.toml")
+	err := os.WriteFile(path, []byte(`
+default_profile = "home"
+
+[profiles.home]
+host = "home.example"
+
+[profiles.tor]
+proxy = "ftp://127.0.0.1:9050"
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, stderr := runCLI(t, "", "config", "--config", path)
+	if code != exitError || !strings.Contains(stderr, `profile "tor"`) {
+		t.Errorf("config validate = %d, %q; want an error for profile tor", code, stderr)
+	}
+}
+
+func TestKeysCommand(t *testing.T) {
+	dir := isolateEnv(t)
+	file := filepath.Join(dir, "id.pem")
+
+	if code, _, stderr := runCLI(t, "\n", "keys", "generate", "--file", file); code != exitError || !strings.Contains(stderr, "must not be empty") {
+		t.Errorf("keys generate with an empty passphrase = %d, %q", code, stderr)
+	}
+	code, generated, stderr := runCLI(t, "secret\n", "keys", "generate", "--file", file)
+	if code != exitOK {
+		t.Fatalf("keys generate = %d: %s", code, stderr)
+	}
+	code, shown, _ := runCLI(t, "secret\n", "keys", "show", "--file", file)
+	if code != exitOK || !strings.Contains(generated, shown) {
+		t.Errorf("keys show = %d, %q; want the generated key %q", code, shown, generated)
+	}
+	if code, _, stderr := runCLI(t, "wrong\n", "keys", "show", "--file", file); code != exitError || !strings.Contains(stderr, "wrong passphrase") {
+		t.Errorf("keys show with a wrong passphrase = %d, %q", code, stderr)
+	}
+	if code, _, stderr := runCLI(t, "secret\n", "keys", "generate", "--file", file); code != exitError || !strings.Contains(stderr, "already exists") {
+		t.Errorf("keys generate over an existing key = %d, %q", code, stderr)
+	}
+	if code, _, stderr := runCLI(t, "", "keys", "delete", "--file", file, "--yes"); code != exitOK {
+		t.Errorf("keys delete = %d: %s", code, stderr)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("key file still exists after delete: %v", err)
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	dir := isolateEnv(t)
+	path := filepath.Join(dir, "history.bin")
+	store, err := history.Open(path, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []history.Entry{
+		{Sender: "alice", Text: "hello bob", Time: 1},
+		{Sender: "bob", Text: "hi alice", Time: 2},
+		{Sender: "mallory\x1b[2J", Text: "\x1b]0;owned\a", Time: 3},
+	} {
+		if err := store.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	code, stdout, stderr := runCLI(t, "secret\n", "history", "search", "--file", path, "hello")
+	if code != exitOK {
+		t.Fatalf("history search = %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "alice: hello bob") || strings.Contains(stdout, "hi alice") {
+		t.Errorf("history search output = %q", stdout)
+	}
+
+	out := filepath.Join(dir, "export.json")
+	t.Setenv("CHAT_HISTORY_FILE", path)
+	code, _, stderr = runCLI(t, "secret\n", "history", "export", "--format", "json", "--output", out)
+	if code != exitOK {
+		t.Fatalf("history export = %d: %s", code, stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []history.Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("export is not JSON: %v\n%s", err, data)
+	}
+	if len(entries) != 3 || entries[1].Sender != "bob" || entries[2].Text != "\x1b]0;owned\a" {
+		t.Errorf("exported entries = %+v", entries)
+	}
+	if info, err := os.Stat(out); err == nil && info.Mode().Perm() != 0o600 {
+		t.Errorf("export file mode = %o, want 600", info.Mode().Perm())
+	}
+
+	code, stdout, stderr = runCLI(t, "secret\n", "history", "export")
+	if code != exitOK {
+		t.Fatalf("history export = %d: %s", code, stderr)
+	}
+	if strings.Contains(stdout, "\x1b") || !strings.Contains(stdout, `mallory\x1b[2J: \x1b]0;owned\x07`) {
+		t.Errorf("history export did not escape control characters: %q", stdout)
+	}
+
+	if code, _, stderr := runCLI(t, "wrong\n", "history", "export"); code != exitError || !strings.Contains(stderr, "passphrase") {
+		t.Errorf("history export with a wrong passphrase = %d, %q", code, stderr)
+	}
+	if code, _, _ := runCLI(t, "secret\n", "history", "export", "--file", filepath.Join(dir, "missing.bin")); code != exitError {
+		t.Errorf("history export of a missing file = %d, want %d", code, exitError)
+	}
+}
+
+func TestHistoryDuressCommand(t *testing.T) {
+	dir := isolateEnv(t)
+	path := filepath.Join(dir, "history.bin")
+	store, err := history.Open(path, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append(history.Entry{Sender: "alice", Text: "hello", Time: 1}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	if code, _, _ := runCLI(t, "secret\n\n", "history", "duress", "--file", path); code != exitError {
+		t.Errorf("history duress with an empty passphrase = %d, want %d", code, exitError)
+	}
+	code, stdout, stderr := runCLI(t, "secret\nduress\n", "history", "duress", "--file", path)
+	if code != exitOK || !strings.Contains(stdout, "Duress passphrase set") {
+		t.Fatalf("history duress = %d: %s%s", code, stdout, stderr)
+	}
+
+	code, stdout, stderr = runCLI(t, "duress\n", "history", "export", "--file", path)
+	if code != exitOK {
+		t.Fatalf("history export with the duress passphrase = %d: %s", code, stderr)
+	}
+	if strings.Contains(stdout, "hello") {
+		t.Errorf("duress passphrase opened the real history: %q", stdout)
+	}
+}
+
+func TestFingerprintCommand(t *testing.T) {
+	isolateEnv(t)
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+	addr := srv.Listener.Addr().String()
+	cert := srv.Certificate()
+	fp := protocol.CertFingerprint(cert)
+
+	code, stdout, stderr := runCLI(t, "", "fingerprint", addr)
+	if code != exitOK {
+		t.Fatalf("fingerprint = %d: %s", code, stderr)
+	}
+	for _, want := range []string{fp, protocol.FormatFingerprint(fp), protocol.SPKIFingerprint(cert)} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("fingerprint output %q does not contain %q", stdout, want)
+		}
+	}
+
+	if code, stdout, _ := runCLI(t, "", "fingerprint", "--fingerprint", protocol.FormatFingerprint(fp), addr); code != exitOK || !strings.Contains(stdout, "Matches") {
+		t.Errorf("fingerprint with the right pin = %d, %q", code, stdout)
+	}
+	if code, _, stderr := runCLI(t, "", "fingerprint", "--fingerprint", strings.Repeat("0", 64), addr); code != exitError || !strings.Contains(stderr, "mismatch") {
+		t.Errorf("fingerprint with a wrong pin = %d, %q", code, stderr)
+	}
+}
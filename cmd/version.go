@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"silent_chat/pkg/protocol"
+)
+
+// version is set at build time with
+// -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// runVersion prints the build and protocol version.
+func runVersion(c *cli, fs *flag.FlagSet, args []string) error {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	fmt.Fprintf(c.stdout, "silent_chat %s\n", buildVersion())
+	fmt.Fprintf(c.stdout, "protocol version %d\n", protocol.Version)
+	fmt.Fprintf(c.stdout, "built with %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}
+
+// buildVersion returns version followed by the VCS revision the binary was
+// built from, or the module version for "go install" builds.
+func buildVersion() string {
+	v := version
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v
+	}
+	if v == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		// Module versions of untagged builds already name the revision.
+		return info.Main.Version
+	}
+
+	var revision, modified, at string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		case "vcs.time":
+			at = s.Value
+		}
+	}
+	if revision == "" {
+		return v
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+	if at != "" {
+		return fmt.Sprintf("%s (%s, %s)", v, revision, at)
+	}
+	return fmt.Sprintf("%s (%s)", v, revision)
+}
@@ -0,0 +1,145 @@
+// Package secret encrypts data at rest with a passphrase. Keys are derived
+// with Argon2id and used for AES-256-GCM. The history store, the outbox and
+// the identity key file all use it.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// SaltSize is the size of the random Argon2id salt.
+	SaltSize = 16
+	// ParamsSize is the size of encoded Params.
+	ParamsSize = SaltSize + 4 + 4 + 1
+	// NonceSize is the size of the AES-GCM nonce in front of sealed data.
+	NonceSize = 12
+	// Overhead is the size added by Seal: the nonce and the GCM tag.
+	Overhead = NonceSize + 16
+
+	keySize = 32
+
+	// Argon2id parameters of new files.
+	defaultTime    = 3
+	defaultMemory  = 64 * 1024 // KiB
+	defaultThreads = 4
+
+	// Bounds on the parameters read from a file. They keep a damaged or
+	// tampered file from crashing argon2 or making it allocate without
+	// limit.
+	maxTime    = 16
+	minMemory  = 8 * 1024   // KiB
+	maxMemory  = 256 * 1024 // KiB
+	maxThreads = 16
+)
+
+var (
+	// ErrInvalidParams is returned for key derivation parameters outside the
+	// accepted bounds.
+	ErrInvalidParams = errors.New("invalid key derivation parameters")
+	// ErrDecrypt is returned by Open when the data does not decrypt with the key.
+	ErrDecrypt = errors.New("decryption failed")
+)
+
+// Params are the salt and Argon2id costs a key is derived with. They are
+// stored in the clear next to the data they protect.
+type Params struct {
+	Salt    []byte
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+}
+
+// NewParams returns the default costs with a fresh random salt.
+func NewParams() (Params, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return Params{}, fmt.Errorf("failed to generate salt: %v", err)
+	}
+	return Params{Salt: salt, Time: defaultTime, Memory: defaultMemory, Threads: defaultThreads}, nil
+}
+
+// ParseParams decodes Params written by Marshal and checks them against the
+// accepted bounds.
+func ParseParams(buf []byte) (Params, error) {
+	if len(buf) != ParamsSize {
+		return Params{}, ErrInvalidParams
+	}
+	p := Params{
+		Salt:    append([]byte(nil), buf[:SaltSize]...),
+		Time:    binary.BigEndian.Uint32(buf[SaltSize:]),
+		Memory:  binary.BigEndian.Uint32(buf[SaltSize+4:]),
+		Threads: buf[SaltSize+8],
+	}
+	if err := p.check(); err != nil {
+		return Params{}, err
+	}
+	return p, nil
+}
+
+// Marshal encodes p in ParamsSize bytes.
+func (p Params) Marshal() []byte {
+	buf := make([]byte, 0, ParamsSize)
+	buf = append(buf, p.Salt...)
+	buf = binary.BigEndian.AppendUint32(buf, p.Time)
+	buf = binary.BigEndian.AppendUint32(buf, p.Memory)
+	return append(buf, p.Threads)
+}
+
+func (p Params) check() error {
+	switch {
+	case len(p.Salt) != SaltSize:
+		return fmt.Errorf("%w: salt of %d bytes", ErrInvalidParams, len(p.Salt))
+	case p.Time < 1 || p.Time > maxTime:
+		return fmt.Errorf("%w: time %d", ErrInvalidParams, p.Time)
+	case p.Memory < minMemory || p.Memory > maxMemory:
+		return fmt.Errorf("%w: memory %d KiB", ErrInvalidParams, p.Memory)
+	case p.Threads < 1 || p.Threads > maxThreads:
+		return fmt.Errorf("%w: %d threads", ErrInvalidParams, p.Threads)
+	}
+	return nil
+}
+
+// AEAD derives the key for passphrase and returns the cipher. The key is
+// wiped once the cipher is set up; the caller may wipe passphrase.
+func (p Params) AEAD(passphrase []byte) (cipher.AEAD, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey(passphrase, p.Salt, p.Time, p.Memory, p.Threads, keySize)
+	defer clear(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts plain with a random nonce and returns the nonce followed by
+// the ciphertext. additionalData is authenticated but not stored.
+func Seal(aead cipher.AEAD, plain, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, NonceSize, NonceSize+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plain, additionalData), nil
+}
+
+// Open decrypts data produced by Seal with the same additionalData.
+func Open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < NonceSize {
+		return nil, ErrDecrypt
+	}
+	plain, err := aead.Open(nil, sealed[:NonceSize], sealed[NonceSize:], additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
@@ -0,0 +1,90 @@
+package secret
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseParams(t *testing.T) {
+	valid, err := NewParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(p *Params)
+		wantErr bool
+	}{
+		{name: "defaults", modify: func(p *Params) {}},
+		{name: "zero threads", modify: func(p *Params) { p.Threads = 0 }, wantErr: true},
+		{name: "too many threads", modify: func(p *Params) { p.Threads = 255 }, wantErr: true},
+		{name: "zero time", modify: func(p *Params) { p.Time = 0 }, wantErr: true},
+		{name: "huge time", modify: func(p *Params) { p.Time = 1 << 30 }, wantErr: true},
+		{name: "tiny memory", modify: func(p *Params) { p.Memory = 1 }, wantErr: true},
+		{name: "huge memory", modify: func(p *Params) { p.Memory = 1 << 31 }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid
+			tt.modify(&p)
+			parsed, err := ParseParams(p.Marshal())
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidParams) {
+					t.Errorf("ParseParams() error = %v, want %v", err, ErrInvalidParams)
+				}
+				if _, err := p.AEAD([]byte("pass")); !errors.Is(err, ErrInvalidParams) {
+					t.Errorf("AEAD() error = %v, want %v", err, ErrInvalidParams)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseParams() error = %v", err)
+			}
+			if string(parsed.Marshal()) != string(p.Marshal()) {
+				t.Errorf("ParseParams() = %+v, want %+v", parsed, p)
+			}
+		})
+	}
+
+	if _, err := ParseParams(valid.Marshal()[1:]); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("ParseParams() of a short buffer error = %v, want %v", err, ErrInvalidParams)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	p, err := NewParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := p.AEAD([]byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Seal(aead, []byte("secret"), []byte("ad"))
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if len(sealed) != len("secret")+Overhead {
+		t.Errorf("len(Seal()) = %d, want %d", len(sealed), len("secret")+Overhead)
+	}
+
+	plain, err := Open(aead, sealed, []byte("ad"))
+	if err != nil || string(plain) != "secret" {
+		t.Errorf("Open() = %q, %v", plain, err)
+	}
+	if _, err := Open(aead, sealed, []byte("other")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Open() with other additional data error = %v, want %v", err, ErrDecrypt)
+	}
+	wrong, err := p.AEAD([]byte("wrong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(wrong, sealed, []byte("ad")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Open() with wrong key error = %v, want %v", err, ErrDecrypt)
+	}
+	if _, err := Open(aead, sealed[:4], []byte("ad")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Open() of truncated data error = %v, want %v", err, ErrDecrypt)
+	}
+}
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"crypto/rand"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/briandowns/spinner"
@@ -22,8 +24,11 @@ func Spinner(message string, duration time.Duration) {
 
 // RandomString generates a random string of the specified length using cryptographically secure random bytes.
 // The string consists of alphanumeric characters (a-z, A-Z, 0-9).
-// Returns an error if random byte generation fails.
+// Returns an error if the length is negative or random byte generation fails.
 func RandomString(length int) (string, error) {
+	if length < 0 {
+		return "", fmt.Errorf("invalid length: %d", length)
+	}
 	charset := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	bytes := make([]byte, length)
 	if _, err := rand.Read(bytes); err != nil {
@@ -36,3 +41,52 @@ func RandomString(length int) (string, error) {
 
 	return string(bytes), nil
 }
+
+// SecureDelete overwrites the file at path with random bytes, syncs it to disk and removes it.
+// A missing file is not an error. On journaling or copy-on-write filesystems and SSDs the
+// overwrite is best effort, so sensitive files should also be encrypted at rest.
+func SecureDelete(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	buf := make([]byte, 32*1024)
+	for remaining := info.Size(); remaining > 0; {
+		chunk := int64(len(buf))
+		if remaining < chunk {
+			chunk = remaining
+		}
+		if _, err := rand.Read(buf[:chunk]); err != nil {
+			file.Close()
+			return err
+		}
+		if _, err := file.Write(buf[:chunk]); err != nil {
+			file.Close()
+			return err
+		}
+		remaining -= chunk
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
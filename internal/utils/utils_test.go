@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -71,7 +73,8 @@ func TestRandomString(t *testing.T) {
 		{
 			name:    "negative length",
 			length:  -1,
-			wantErr: false,
+			wantErr: true,
+			errMsg:  "invalid length",
 		},
 	}
 
@@ -107,3 +110,43 @@ func TestRandomString(t *testing.T) {
 		})
 	}
 }
+
+func TestSecureDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		create  bool
+	}{
+		{
+			name:    "small file",
+			content: []byte("secret"),
+			create:  true,
+		},
+		{
+			name:    "file larger than buffer",
+			content: []byte(strings.Repeat("x", 100*1024)),
+			create:  true,
+		},
+		{
+			name:   "missing file",
+			create: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "target")
+			if tt.create {
+				if err := os.WriteFile(path, tt.content, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := SecureDelete(path); err != nil {
+				t.Errorf("SecureDelete() error = %v", err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("file still exists after SecureDelete(): %v", err)
+			}
+		})
+	}
+}
@@ -1,406 +1,298 @@
+// Package client implements the silent_chat connection as a UI-agnostic
+// library. Dial establishes an authenticated session; the caller sends
+// messages with Session.Send and consumes incoming messages, state changes
+// and errors from Session.Events.
 package client
 
 import (
 	"context"
 	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
-	"encoding/binary"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"math/rand"
+	"log/slog"
 	"net"
-	"os"
-	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
-	"silent_chat/internal/utils"
 	"silent_chat/pkg/config"
 	"silent_chat/pkg/protocol"
-	"silent_chat/pkg/ui"
-
-	tea "github.com/charmbracelet/bubbletea"
+	"silent_chat/pkg/transcript"
 )
 
-const clearScreen = "\033[2J\033[H"
-
-type Client struct {
-	Conn        *tls.Conn
-	Addr        string
-	Username    string
+// Options holds the parameters of a single connection.
+type Options struct {
+	Host string
+	Port string
+	// Endpoints lists the addresses of the server in priority order. If
+	// empty, Host and Port name the only endpoint.
+	Endpoints []Endpoint
+	Username  string
+	Password  string
+	// ResumeToken, if set, authenticates with a token issued by a previous
+	// session instead of the password.
+	ResumeToken string
 	Config      *config.Config
-	Mutex       sync.Mutex
-	OutputMutex sync.Mutex
-	Connected   bool
+	// Machine receives the state transitions of the connection. If nil, Dial
+	// creates a private one, available through Session.Machine.
+	Machine *Machine
+	// Transport opens the connection. If nil, NewTransport(Config) is used.
+	Transport Transport
+	// Logger receives the session's diagnostics. If nil, slog.Default is used.
+	Logger *slog.Logger
+	// Metrics, if set, counts the session's traffic. Share one Metrics
+	// between the Dial calls of a client to track reconnects.
+	Metrics *Metrics
+	// Transcript links the chat messages of the session. Share one Chain
+	// between the Dial calls of a client, so that a reconnect does not
+	// break the chain for the other participants. If nil, Dial creates one.
+	Transcript *transcript.Chain
 }
 
-func (c *Client) ReadMessage() (protocol.Message, error) {
-	header := make([]byte, 4)
-
-	if _, err := io.ReadFull(c.Conn, header); err != nil {
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			return protocol.Message{}, fmt.Errorf(
-				"header read timeout: %v",
-				err,
-			)
-		}
-		return protocol.Message{}, fmt.Errorf("failed to read header: %v", err)
+// endpoints returns the endpoints to connect to, in priority order.
+func (o Options) endpoints() []Endpoint {
+	if len(o.Endpoints) > 0 {
+		return o.Endpoints
 	}
+	return []Endpoint{{Host: o.Host, Port: o.Port}}
+}
 
-	size := binary.BigEndian.Uint32(header)
-	if size == 0 {
-		return protocol.Message{}, fmt.Errorf("packet size is zero")
+// Dial connects to the server, verifies its certificate fingerprint,
+// authenticates and returns a running Session. With several endpoints, the
+// first one to complete the TLS handshake and certificate check is used, as
+// described for Config.EndpointAttemptDelay.
+func Dial(ctx context.Context, opts Options) (*Session, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = config.NewConfig()
 	}
-	if size > c.Config.MaxPacketSize {
-		return protocol.Message{}, fmt.Errorf("packet too large: %d", size)
+	machine, ownsMachine := opts.Machine, false
+	if machine == nil {
+		machine, ownsMachine = NewMachine(), true
 	}
-	if size > c.Config.AbsoluteMaxPacketSize {
-		return protocol.Message{}, fmt.Errorf(
-			"packet too large or attack detected: %v",
-			size,
-		)
+	endpoints := opts.endpoints()
+	addr := endpoints[0].Addr()
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
 	}
 
-	body := make([]byte, size)
-	if _, err := io.ReadFull(c.Conn, body); err != nil {
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			return protocol.Message{}, fmt.Errorf("body read timeout: %v", err)
+	metrics := opts.Metrics
+	metrics.dialStarted()
+
+	fail := func(conn net.Conn, err error) (*Session, error) {
+		logger.Warn("connection failed", "addr", addr, "err", err)
+		metrics.dialFailed(err)
+		if conn != nil {
+			conn.Close()
 		}
-		return protocol.Message{}, fmt.Errorf("failed to read body: %v", err)
+		machine.Transition(StateDisconnected, err)
+		if ownsMachine {
+			machine.Close()
+		}
+		return nil, err
 	}
 
-	var msg protocol.Message
-	if err := json.Unmarshal(body, &msg); err != nil {
-		return protocol.Message{}, fmt.Errorf("failed to decode JSON: %v", err)
+	if err := machine.Transition(StateDialing, nil); err != nil {
+		return fail(nil, err)
 	}
 
-	return msg, nil
-}
-
-func (c *Client) WriteMessage(msg protocol.Message) error {
-	c.Mutex.Lock()
-	defer c.Mutex.Unlock()
-
-	if !c.Connected {
-		return fmt.Errorf("not connected")
+	transport := opts.Transport
+	if transport == nil {
+		var err error
+		if transport, err = NewTransport(cfg); err != nil {
+			return fail(nil, err)
+		}
 	}
 
-	data, err := protocol.EncodeMessage(msg, c.Config)
-	if err != nil {
-		return err
+	dial := func(ctx context.Context, e Endpoint) (net.Conn, tls.ConnectionState, error) {
+		logger.Debug("dialing", "addr", e.Addr())
+		return dialVerified(ctx, transport, e, cfg, func() {
+			machine.Transition(StateVerifying, nil)
+		})
 	}
-	n, err := c.Conn.Write(data)
+	conn, state, index, err := raceEndpoints(ctx, endpoints, cfg.EndpointAttemptDelay, dial)
 	if err != nil {
-		c.Connected = false
-		return fmt.Errorf("failed to write message: %v", err)
+		return fail(nil, err)
 	}
-	if n != len(data) {
-		c.Connected = false
-		return fmt.Errorf("incomplete write: wrote %d bytes out of %d",
-			n, len(data))
+	endpoint := endpoints[index]
+	addr = endpoint.Addr()
+	fingerprint := protocol.CertFingerprint(state.PeerCertificates[0])
+
+	// Abort the verification and authentication round trip if ctx is
+	// cancelled by expiring all pending I/O on the connection.
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	machine.Transition(StateAuthenticating, nil)
+	s := newSession(conn, addr, opts.Username, cfg, machine)
+	s.endpoint = endpoint
+	s.fallback = index > 0
+	s.ownsMachine = ownsMachine
+	s.fingerprint = fingerprint
+	s.logger = logger
+	s.metrics = metrics
+	if opts.Transcript != nil {
+		s.transcript = opts.Transcript
 	}
-	return nil
-}
 
-func (c *Client) SendFakeMessage() error {
-	randInt := rand.Intn(39) + 1
-	randString, err := utils.RandomString(randInt)
-	if err != nil {
-		return fmt.Errorf("failed to generate random string: %v", err)
+	authMsg := protocol.Message{
+		Type:     "auth",
+		Username: opts.Username,
 	}
-	fake := protocol.Message{
-		Type: "fake",
-		Text: randString,
+	if opts.ResumeToken != "" {
+		authMsg.ResumeToken = opts.ResumeToken
+	} else {
+		hash := sha256.Sum256([]byte(opts.Password))
+		authMsg.Password = base64.StdEncoding.EncodeToString(hash[:])
 	}
-
-	return c.WriteMessage(fake)
-}
-
-func (c *Client) Connect() error {
-	model := ui.NewAuthModel()
-	p := tea.NewProgram(model)
-	result, err := p.Run()
-	if err != nil {
-		return fmt.Errorf("auth UI error: %v", err)
+	authSent := time.Now()
+	if err := s.writeMessage(authMsg); err != nil {
+		return fail(conn, err)
 	}
 
-	authModel, ok := result.(ui.AuthModel)
-	if !ok {
-		return fmt.Errorf("unexpected model type")
+	deadline := time.Now().Add(cfg.AuthTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
 	}
-
-	authData, err := authModel.GetAuthData()
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return fail(conn, fmt.Errorf("read deadline err: %v", err))
+	}
+	resp, err := s.readMessage()
 	if err != nil {
-		os.Exit(1)
+		if ctx.Err() != nil {
+			return fail(conn, fmt.Errorf("authentication cancelled: %w", ctx.Err()))
+		}
+		if isTimeout(err) {
+			return fail(conn, fmt.Errorf("authentication timeout: %w", err))
+		}
+		return fail(conn, fmt.Errorf("authentication error: %w", err))
 	}
-
-	c.Addr = authData.Host + ":" + authData.Port
-
-	c.Username = authData.Username
-
-	passwordString := authData.Password
-	passwordBytes := []byte(passwordString)
-
-	hash := sha256.Sum256(passwordBytes)
-	hashedPassword := base64.StdEncoding.EncodeToString(hash[:])
-
-	config := &tls.Config{
-		InsecureSkipVerify: true,
+	metrics.observeRTT(time.Since(authSent))
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return fail(conn, fmt.Errorf("read deadline err: %v", err))
 	}
 
-	dialer := &net.Dialer{Timeout: c.Config.DialTimeout}
-	conn, err := tls.DialWithDialer(dialer, "tcp", c.Addr, config)
-	if err != nil {
-		return fmt.Errorf("dial failed: %v", err)
+	if resp.Type != "auth_result" {
+		return fail(conn, fmt.Errorf("%w: unexpected response from server", ErrProtocol))
 	}
-
-	if err := protocol.VerifyFingerprint(conn, c.Config.ExpectedFP); err != nil {
-		if closeErr := conn.Close(); closeErr != nil {
-			log.Printf("failed to close connection: %v", closeErr)
+	if !resp.Success {
+		if opts.ResumeToken != "" {
+			return fail(conn, fmt.Errorf("%w: %s", ErrResumeRejected, resp.Error))
 		}
-		return err
+		return fail(conn, fmt.Errorf("%w: %s", ErrAuthFailed, resp.Error))
 	}
-
-	fmt.Printf("Connected to %s\n", c.Addr)
-
-	c.Conn = conn
-	c.Connected = true
-
-	authMsg := protocol.Message{
-		Type:     "auth",
-		Password: hashedPassword,
-		Username: c.Username,
-	}
-	if err := c.WriteMessage(authMsg); err != nil {
-		c.Connected = false
-		if closeErr := conn.Close(); closeErr != nil {
-			log.Printf("failed to close connection: %v", closeErr)
+	s.resumeToken = resp.ResumeToken
+	switch {
+	case resp.Nonce != "":
+		// auth_result is the first frame stamped with the nonce. Recording
+		// it means a copy of it is rejected later in the session.
+		s.setNonce(resp.Nonce)
+		if err := s.replay.Check(resp); err != nil {
+			return fail(conn, err)
 		}
-
-		return err
+	case cfg.RequireReplayProtection:
+		return fail(conn, fmt.Errorf("%w: server did not issue a session nonce", ErrProtocol))
+	default:
+		logger.Warn("server did not issue a session nonce, replay protection is off", "addr", addr)
 	}
 
-	if setDeadlineErr := conn.SetReadDeadline(time.Now().Add(c.Config.AuthTimeout)); setDeadlineErr != nil {
-		log.Printf("read deadline err: %v", setDeadlineErr)
+	if !stop() {
+		return fail(conn, fmt.Errorf("authentication cancelled: %w", ctx.Err()))
 	}
-	resp, err := c.ReadMessage()
-	if setDeadlineErr := conn.SetReadDeadline(time.Time{}); setDeadlineErr != nil {
-		log.Printf("read deadline err: %v", setDeadlineErr)
-	}
-	if err != nil {
-		c.Connected = false
-		if closeErr := conn.Close(); closeErr != nil {
-			log.Printf("failed to close connection: %v", closeErr)
-		}
-
-		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			return fmt.Errorf("authentication timeout")
-		}
-		return fmt.Errorf("authentication error: %v", err)
+	if err := machine.Transition(StateReady, nil); err != nil {
+		return fail(conn, err)
 	}
+	logger.Info("session established", "addr", addr, "username", opts.Username,
+		"resumed", opts.ResumeToken != "", "fallback", index > 0)
+	metrics.connected()
+	s.start()
+	return s, nil
+}
 
-	if resp.Type == "auth_result" {
-		if resp.Success {
-			fmt.Printf("Authentication successful. Username: %s\n", c.Username)
+// dialVerified opens a connection to e with transport and checks the server
+// certificate against the pinned fingerprints in cfg during the handshake. The
+// server certificate is self-signed and pinned by fingerprint, so chain
+// verification is replaced by the pin check. verifying, if not nil, is
+// called when the check starts.
+func dialVerified(ctx context.Context, transport Transport, e Endpoint, cfg *config.Config, verifying func()) (net.Conn, tls.ConnectionState, error) {
+	var verified atomic.Bool
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if verifying != nil {
+				verifying()
+			}
+			if err := protocol.VerifyPeerCertificates(cs.PeerCertificates, cfg.ExpectedFP, cfg.BackupFPs...); err != nil {
+				return err
+			}
+			verified.Store(true)
 			return nil
+		},
+	}
+	conn, state, err := transport.Dial(ctx, e.Addr(), tlsConfig)
+	if err != nil {
+		if !errors.Is(err, ErrFingerprintMismatch) {
+			err = &NetworkError{Op: "dial", Err: err}
 		}
-		fmt.Printf("Authentication failed: %s\n", resp.Error)
-
-		c.Connected = false
-		if closeErr := conn.Close(); closeErr != nil {
-			log.Printf("failed to close connection: %v", closeErr)
-		}
-
-		return fmt.Errorf("authentication failed: %s", resp.Error)
+		return nil, tls.ConnectionState{}, err
 	}
-
-	c.Connected = false
-	if closeErr := conn.Close(); closeErr != nil {
-		log.Printf("failed to close connection: %v", closeErr)
+	if !verified.Load() || len(state.PeerCertificates) == 0 {
+		conn.Close()
+		return nil, tls.ConnectionState{}, fmt.Errorf("%w: transport skipped certificate verification", ErrProtocol)
 	}
-
-	return fmt.Errorf("unexpected response from server")
+	return conn, state, nil
 }
 
-func (c *Client) Listen(p *tea.Program) {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("Listen goroutine recovered from panic: %v\n", r)
-		}
-	}()
-
-	for {
-		if !c.Connected {
-			return
-		}
-
-		var msg protocol.Message
+// Probe checks whether the server at e is reachable and presents the pinned
+// certificate, without authenticating. Callers use it to find out when a
+// preferred endpoint has recovered.
+func Probe(ctx context.Context, opts Options, e Endpoint) error {
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = config.NewConfig()
+	}
+	transport := opts.Transport
+	if transport == nil {
 		var err error
-
-		if c.Config.ReadTimeout > 0 {
-			ctx, cancel := context.WithTimeout(
-				context.Background(),
-				c.Config.ReadTimeout,
-			)
-			defer cancel()
-
-			msgChan := make(chan protocol.Message, 1)
-			errChan := make(chan error, 1)
-
-			go func() {
-				msg, err := c.ReadMessage()
-				if err != nil {
-					errChan <- err
-				} else {
-					msgChan <- msg
-				}
-			}()
-
-			select {
-			case msg = <-msgChan:
-			case err = <-errChan:
-			case <-ctx.Done():
-				err = ctx.Err()
-			}
-		} else {
-			msg, err = c.ReadMessage()
-		}
-
-		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				continue
-			}
-
-			if strings.Contains(err.Error(), "EOF") ||
-				strings.Contains(
-					err.Error(),
-					"use of closed network connection",
-				) {
-				p.Quit()
-				return
-			}
-
-			fmt.Printf("\nNetwork error: %v\n", err)
-			c.Connected = false
-			return
-		}
-
-		if msg.Type == "chat" && msg.Text != "" && msg.SenderName != "" {
-			p.Send(ui.NewChatMsg{
-				Sender: msg.SenderName,
-				Text:   msg.Text,
-			})
+		if transport, err = NewTransport(cfg); err != nil {
+			return err
 		}
 	}
+	conn, _, err := dialVerified(ctx, transport, e, cfg, nil)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
 }
 
-func (c *Client) Run() error {
-	retryCount := 0
-
-	for {
-		fmt.Print(clearScreen)
-		err := c.Connect()
-		if err != nil {
-			retryCount++
-
-			if strings.Contains(err.Error(), "authentication failed") {
-				fmt.Printf(
-					"Authentication failed. Retrying in %v...\n",
-					c.Config.AuthFailDelay,
-				)
-				utils.Spinner("Waiting", c.Config.AuthFailDelay)
-				continue
-			}
-
-			if retryCount >= c.Config.MaxRetries {
-				backoffDelay := c.Config.ReconnectDelay + c.Config.BackoffIncrement*time.Duration(
-					retryCount-c.Config.MaxRetries,
-				)
-
-				fmt.Printf(
-					"Max retries reached. Backing off for %v...\n",
-					backoffDelay,
-				)
-				utils.Spinner("Reconnecting ...", backoffDelay)
-			} else {
-				fmt.Printf("Connection failed. Retrying in %v... (attempt %d/%d)\n",
-					c.Config.ReconnectDelay, retryCount, c.Config.MaxRetries)
-				utils.Spinner("Reconnecting", c.Config.ReconnectDelay)
-			}
-			continue
-		}
-
-		retryCount = 0
-
-		delay := time.Duration(rand.Intn(30)+1) * time.Second
-
-		stopFake := make(chan struct{})
-
-		go func() {
-			ticker := time.NewTicker(delay)
-			defer ticker.Stop()
-			for {
-				select {
-				case <-stopFake:
-					return
-				case <-ticker.C:
-					if c.Connected {
-						if err := c.SendFakeMessage(); err != nil {
-							log.Printf("send fake message, err: %v", err)
-						}
-					}
-				}
-			}
-		}()
-
-		chatModel := ui.NewChatModel(c.Username, func(text string) {
-			msgData := protocol.Message{
-				Type:       "chat",
-				Text:       text,
-				SenderName: c.Username,
-			}
-
-			delay := time.Duration(rand.Intn(300)) * time.Millisecond
-			time.Sleep(delay)
-
-			if err := c.WriteMessage(msgData); err != nil {
-				fmt.Printf("Failed to send message: %v\n", err)
-				c.Connected = false
-			}
-		})
-
-		p := tea.NewProgram(chatModel, tea.WithAltScreen())
-
-		listenDone := make(chan struct{})
-		go func() {
-			c.Listen(p)
-			close(listenDone)
-		}()
-
-		finalModel, err := p.Run()
-
-		close(stopFake)
-
-		if c.Conn != nil {
-			c.Connected = false
-			if closeErr := c.Conn.Close(); closeErr != nil {
-				log.Printf("failed to close connection: %v", closeErr)
-			}
-		}
-
-		<-listenDone
-
-		if err == nil {
-			if _, ok := finalModel.(ui.ChatModel); ok {
-				fmt.Println("God loves the patient. Internet respects privacy.")
-				return nil
-			}
+// FetchCertificate connects to e with the transport and proxy settings of
+// opts and returns the server's leaf certificate without checking it against
+// a pin, so that the user can compare it out of band before pinning it. It
+// does not authenticate.
+func FetchCertificate(ctx context.Context, opts Options, e Endpoint) (*x509.Certificate, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = config.NewConfig()
+	}
+	transport := opts.Transport
+	if transport == nil {
+		var err error
+		if transport, err = NewTransport(cfg); err != nil {
+			return nil, err
 		}
-
-		fmt.Printf("Reconnecting in %v...\n", c.Config.ReconnectDelay)
-		utils.Spinner("Reconnecting", c.Config.ReconnectDelay)
 	}
+	conn, state, err := transport.Dial(ctx, e.Addr(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return nil, &NetworkError{Op: "dial", Err: err}
+	}
+	conn.Close()
+	if len(state.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("%w: no server certificates found", ErrProtocol)
+	}
+	return state.PeerCertificates[0], nil
 }
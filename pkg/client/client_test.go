@@ -0,0 +1,398 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"silent_chat/pkg/config"
+	"silent_chat/pkg/protocol"
+	"silent_chat/pkg/transcript"
+)
+
+const testResumeToken = "resume-1"
+
+// testServer is a minimal in-process chat server speaking the framed JSON protocol over TLS.
+type testServer struct {
+	addr        string
+	fingerprint string
+	allow       bool
+	conns       chan *serverConn
+	// noNonce makes the server behave like one without replay protection,
+	// which issues no session nonce.
+	noNonce bool
+}
+
+// serverConn is the server side of one accepted client connection.
+type serverConn struct {
+	t     *testing.T
+	conn  net.Conn
+	nonce string
+	seq   uint64
+	auth  protocol.Message
+}
+
+func newTestCert(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "silent_chat test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, hex.EncodeToString(sum[:])
+}
+
+// newTestServer starts a TLS server. Every accepted connection is
+// authenticated with accept and then handed to the test through conns.
+func newTestServer(t *testing.T, accept bool) *testServer {
+	t.Helper()
+	cert, fp := newTestCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		addr:        ln.Addr().String(),
+		fingerprint: fp,
+		allow:       accept,
+		conns:       make(chan *serverConn, 4),
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.handle(t, conn)
+		}
+	}()
+	return s
+}
+
+// handle authenticates a new connection and hands it to the test.
+func (s *testServer) handle(t *testing.T, conn net.Conn) {
+	sc := &serverConn{t: t, conn: conn}
+	auth, err := sc.read()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	sc.auth = auth
+	if !s.noNonce {
+		sc.nonce = rand.Text()
+	}
+	result := protocol.Message{Type: "auth_result", Success: s.allow}
+	switch {
+	case auth.ResumeToken != "" && auth.ResumeToken != testResumeToken:
+		result.Success = false
+		result.Error = "unknown token"
+	case !s.allow:
+		result.Error = "invalid password"
+	default:
+		result.ResumeToken = testResumeToken
+	}
+	sc.write(result)
+	s.conns <- sc
+}
+
+func (s *testServer) options(t *testing.T) Options {
+	host, port, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.NewConfig()
+	cfg.ExpectedFP = s.fingerprint
+	return Options{Host: host, Port: port, Username: "alice", Password: "secret", Config: cfg}
+}
+
+func (s *testServer) accept(t *testing.T) *serverConn {
+	t.Helper()
+	select {
+	case sc := <-s.conns:
+		t.Cleanup(func() { sc.conn.Close() })
+		return sc
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection accepted")
+		return nil
+	}
+}
+
+func (sc *serverConn) read() (protocol.Message, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(sc.conn, header); err != nil {
+		return protocol.Message{}, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := io.ReadFull(sc.conn, body); err != nil {
+		return protocol.Message{}, err
+	}
+	var msg protocol.Message
+	err := json.Unmarshal(body, &msg)
+	return msg, err
+}
+
+// readType reads frames until one of the given type arrives, skipping fake traffic.
+func (sc *serverConn) readType(typ string) protocol.Message {
+	sc.t.Helper()
+	sc.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer sc.conn.SetReadDeadline(time.Time{})
+	for {
+		msg, err := sc.read()
+		if err != nil {
+			sc.t.Fatalf("server read: %v", err)
+		}
+		if msg.Type == typ {
+			return msg
+		}
+	}
+}
+
+// write sends a frame stamped with the session nonce and the next sequence number.
+func (sc *serverConn) write(msg protocol.Message) {
+	sc.seq++
+	msg.Nonce = sc.nonce
+	msg.Seq = sc.seq
+	sc.writeRaw(msg)
+}
+
+func (sc *serverConn) writeRaw(msg protocol.Message) {
+	data, err := protocol.EncodeMessage(msg, config.NewConfig())
+	if err != nil {
+		sc.t.Errorf("encode: %v", err)
+		return
+	}
+	if _, err := sc.conn.Write(data); err != nil {
+		sc.t.Logf("server write: %v", err)
+	}
+}
+
+// nextEvent returns the next event of type T, skipping other events.
+func nextEvent[T Event](t *testing.T, s *Session) T {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-s.Events():
+			if !ok {
+				t.Fatal("events channel closed")
+			}
+			if want, ok := ev.(T); ok {
+				return want
+			}
+		case <-timeout:
+			var zero T
+			t.Fatalf("timed out waiting for %T", zero)
+		}
+	}
+}
+
+func TestDialSendReceive(t *testing.T) {
+	srv := newTestServer(t, true)
+	session, err := Dial(context.Background(), srv.options(t))
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer session.Close()
+	sc := srv.accept(t)
+
+	if sc.auth.Type != "auth" || sc.auth.Username != "alice" || sc.auth.Password == "secret" {
+		t.Errorf("unexpected auth frame: %+v", sc.auth)
+	}
+
+	if err := session.Send(context.Background(), protocol.Message{Type: "chat", Text: "hi"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	got := sc.readType("chat")
+	if got.Text != "hi" || got.SenderName != "alice" || got.ID == "" {
+		t.Errorf("server received %+v", got)
+	}
+
+	sc.write(protocol.Message{Type: "chat", Text: "hello", SenderName: "bob", ID: "1"})
+	ev := nextEvent[MessageEvent](t, session)
+	if ev.Message.Text != "hello" || ev.Message.SenderName != "bob" {
+		t.Errorf("received %+v", ev.Message)
+	}
+
+	sc.writeRaw(protocol.Message{Type: "chat", Text: "replayed", SenderName: "bob", Nonce: sc.nonce, Seq: 1})
+	if errEv := nextEvent[ErrorEvent](t, session); errEv.Err == nil {
+		t.Error("replayed frame was not reported")
+	}
+
+	sc.conn.Close()
+	state := nextEvent[StateEvent](t, session)
+	if state.State != StateDisconnected {
+		t.Errorf("state = %v, want %v", state.State, StateDisconnected)
+	}
+}
+
+func TestDialWithoutSessionNonce(t *testing.T) {
+	srv := newTestServer(t, true)
+	srv.noNonce = true
+
+	session, err := Dial(context.Background(), srv.options(t))
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer session.Close()
+	sc := srv.accept(t)
+	sc.writeRaw(protocol.Message{Type: "chat", ID: "1", Text: "hello", SenderName: "bob"})
+	if ev := nextEvent[MessageEvent](t, session); ev.Message.Text != "hello" {
+		t.Errorf("received %+v", ev.Message)
+	}
+
+	opts := srv.options(t)
+	opts.Config.RequireReplayProtection = true
+	if _, err := Dial(context.Background(), opts); !errors.Is(err, ErrProtocol) {
+		t.Errorf("Dial() requiring replay protection error = %v, want %v", err, ErrProtocol)
+	}
+}
+
+func TestDialAuthFailed(t *testing.T) {
+	srv := newTestServer(t, false)
+	_, err := Dial(context.Background(), srv.options(t))
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("Dial() error = %v, want %v", err, ErrAuthFailed)
+	}
+}
+
+func TestDialFingerprintMismatch(t *testing.T) {
+	srv := newTestServer(t, true)
+	opts := srv.options(t)
+	opts.Config.ExpectedFP = "00"
+	if _, err := Dial(context.Background(), opts); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Fatalf("Dial() error = %v, want %v", err, ErrFingerprintMismatch)
+	}
+}
+
+func TestDialCancelledDuringAuth(t *testing.T) {
+	cert, fp := newTestCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	cfg := config.NewConfig()
+	cfg.ExpectedFP = fp
+	cfg.AuthTimeout = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = Dial(ctx, Options{Host: host, Port: port, Username: "alice", Password: "x", Config: cfg})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Dial() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Dial() took %v after cancellation", elapsed)
+	}
+}
+
+func TestDialResumeToken(t *testing.T) {
+	srv := newTestServer(t, true)
+	opts := srv.options(t)
+
+	session, err := Dial(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.accept(t)
+	if session.ResumeToken() != testResumeToken {
+		t.Fatalf("ResumeToken() = %q, want %q", session.ResumeToken(), testResumeToken)
+	}
+	session.Close()
+
+	opts.Password = ""
+	opts.ResumeToken = session.ResumeToken()
+	resumed, err := Dial(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Dial() with resume token error = %v", err)
+	}
+	sc := srv.accept(t)
+	if sc.auth.Password != "" || sc.auth.ResumeToken != testResumeToken {
+		t.Errorf("resume auth frame = %+v", sc.auth)
+	}
+	resumed.Close()
+
+	opts.ResumeToken = "stale"
+	if _, err := Dial(context.Background(), opts); !errors.Is(err, ErrResumeRejected) {
+		t.Errorf("Dial() with stale token error = %v, want ErrResumeRejected", err)
+	}
+}
+
+func TestTranscriptSurvivesReconnect(t *testing.T) {
+	srv := newTestServer(t, true)
+	opts := srv.options(t)
+	opts.Config.SendJitter = 0
+	opts.Transcript = transcript.NewChain("alice")
+
+	var prev protocol.Message
+	for i, text := range []string{"before", "after reconnect"} {
+		session, err := Dial(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		sc := srv.accept(t)
+		if err := session.Send(context.Background(), protocol.Message{Type: "chat", Text: text}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		got := sc.readType("chat")
+		if i > 0 && got.PrevHash != transcript.Hash(prev) {
+			t.Errorf("PrevHash after reconnect = %q, want the hash of the previous message", got.PrevHash)
+		}
+		prev = got
+		session.Close()
+	}
+}
+
+func TestDialBackupFingerprint(t *testing.T) {
+	srv := newTestServer(t, true)
+	opts := srv.options(t)
+	opts.Config.ExpectedFP = strings.Repeat("0", 64)
+	opts.Config.BackupFPs = []string{strings.Repeat("1", 64), srv.fingerprint}
+
+	session, err := Dial(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer session.Close()
+	srv.accept(t)
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Endpoint is one address the chat server can be reached at.
+type Endpoint struct {
+	Host string
+	Port string
+}
+
+// Addr returns the endpoint as host:port, with IPv6 literals in brackets.
+func (e Endpoint) Addr() string {
+	return net.JoinHostPort(e.Host, e.Port)
+}
+
+func (e Endpoint) String() string {
+	return e.Addr()
+}
+
+// ParseEndpoint parses "host:port" or "[ipv6]:port". A host without a port,
+// including a bare IPv6 literal, uses defaultPort if it is not empty.
+func ParseEndpoint(s, defaultPort string) (Endpoint, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Endpoint{}, fmt.Errorf("empty endpoint")
+	}
+
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		host, port = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"), defaultPort
+		if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+			return Endpoint{}, fmt.Errorf("invalid endpoint %q: %v", s, err)
+		}
+		if port == "" {
+			return Endpoint{}, fmt.Errorf("invalid endpoint %q: missing port", s)
+		}
+	}
+	if host == "" {
+		return Endpoint{}, fmt.Errorf("invalid endpoint %q: missing host", s)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return Endpoint{}, fmt.Errorf("invalid endpoint %q: port must be a number between 1 and 65535", s)
+	}
+	return Endpoint{Host: host, Port: port}, nil
+}
+
+// ParseEndpoints parses a comma-separated list of endpoints with
+// ParseEndpoint.
+func ParseEndpoints(s, defaultPort string) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	for _, field := range strings.Split(s, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		e, err := ParseEndpoint(field, defaultPort)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, nil
+}
+
+// dialFunc opens a verified connection to one endpoint.
+type dialFunc func(ctx context.Context, e Endpoint) (net.Conn, tls.ConnectionState, error)
+
+// raceEndpoints connects to the endpoints in priority order, "happy
+// eyeballs" style (RFC 8305): each attempt gets a head start of delay, after
+// which the next endpoint is tried in parallel, or at once if the attempt
+// fails earlier. The first connection to succeed wins and the others are
+// cancelled. It returns the index of the winning endpoint.
+func raceEndpoints(ctx context.Context, endpoints []Endpoint, delay time.Duration, dial dialFunc) (net.Conn, tls.ConnectionState, int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		index int
+		conn  net.Conn
+		state tls.ConnectionState
+		err   error
+	}
+	results := make(chan result, len(endpoints))
+	errs := make([]error, len(endpoints))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	next, pending := 0, 0
+	start := func() {
+		i := next
+		next++
+		pending++
+		timer.Reset(delay)
+		go func() {
+			conn, state, err := dial(ctx, endpoints[i])
+			results <- result{index: i, conn: conn, state: state, err: err}
+		}()
+	}
+	more := func() bool {
+		return next < len(endpoints) && ctx.Err() == nil
+	}
+
+	start()
+	for pending > 0 {
+		var headStart <-chan time.Time
+		if more() {
+			headStart = timer.C
+		}
+
+		select {
+		case <-headStart:
+			start()
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				cancel()
+				// Close the connections of attempts that finish anyway.
+				go func(n int) {
+					for ; n > 0; n-- {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, r.state, r.index, nil
+			}
+			errs[r.index] = r.err
+			if more() {
+				start()
+			}
+		}
+	}
+	return nil, tls.ConnectionState{}, 0, firstError(errs)
+}
+
+// firstError picks the error to report when every endpoint failed: a
+// certificate mismatch on any endpoint, since it may be an attack, and
+// otherwise the error of the endpoint with the highest priority.
+func firstError(errs []error) error {
+	var first error
+	for _, err := range errs {
+		if errors.Is(err, ErrFingerprintMismatch) {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,265 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"silent_chat/pkg/protocol"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		in          string
+		defaultPort string
+		want        Endpoint
+		wantAddr    string
+		wantErr     bool
+	}{
+		{in: "chat.example:4000", want: Endpoint{"chat.example", "4000"}, wantAddr: "chat.example:4000"},
+		{in: " 10.0.0.1:4000 ", want: Endpoint{"10.0.0.1", "4000"}, wantAddr: "10.0.0.1:4000"},
+		{in: "[2001:db8::1]:4000", want: Endpoint{"2001:db8::1", "4000"}, wantAddr: "[2001:db8::1]:4000"},
+		{in: "2001:db8::1", defaultPort: "4000", want: Endpoint{"2001:db8::1", "4000"}, wantAddr: "[2001:db8::1]:4000"},
+		{in: "[::1]", defaultPort: "4000", want: Endpoint{"::1", "4000"}, wantAddr: "[::1]:4000"},
+		{in: "chat.example", defaultPort: "4000", want: Endpoint{"chat.example", "4000"}, wantAddr: "chat.example:4000"},
+		{in: "chat.example", wantErr: true},
+		{in: "chat.example:0", wantErr: true},
+		{in: "chat.example:http", wantErr: true},
+		{in: ":4000", wantErr: true},
+		{in: "a:b:c", defaultPort: "4000", wantErr: true},
+		{in: "", defaultPort: "4000", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEndpoint(tt.in, tt.defaultPort)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseEndpoint(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got != tt.want || got.Addr() != tt.wantAddr {
+			t.Errorf("ParseEndpoint(%q) = %+v (%s), want %+v (%s)", tt.in, got, got.Addr(), tt.want, tt.wantAddr)
+		}
+	}
+
+	list, err := ParseEndpoints("a.example:1, [::1]:2,,b.example", "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Endpoint{{"a.example", "1"}, {"::1", "2"}, {"b.example", "3"}}
+	if len(list) != len(want) {
+		t.Fatalf("ParseEndpoints() = %v, want %v", list, want)
+	}
+	for i := range want {
+		if list[i] != want[i] {
+			t.Errorf("ParseEndpoints()[%d] = %v, want %v", i, list[i], want[i])
+		}
+	}
+}
+
+// fakeAttempt describes how a fake dial to one endpoint behaves.
+type fakeAttempt struct {
+	after time.Duration
+	err   error
+}
+
+func TestRaceEndpoints(t *testing.T) {
+	errDown := errors.New("down")
+	mismatch := fmt.Errorf("%w: expected a, got b", ErrFingerprintMismatch)
+	tests := []struct {
+		name        string
+		attempts    []fakeAttempt
+		wantIndex   int
+		wantErr     error
+		wantStarted int
+		maxDuration time.Duration
+	}{
+		{
+			name:        "primary wins within its head start",
+			attempts:    []fakeAttempt{{after: 10 * time.Millisecond}, {}},
+			wantIndex:   0,
+			wantStarted: 1,
+		},
+		{
+			name:        "slow primary loses to backup",
+			attempts:    []fakeAttempt{{after: time.Second}, {after: 10 * time.Millisecond}},
+			wantIndex:   1,
+			wantStarted: 2,
+			maxDuration: 500 * time.Millisecond,
+		},
+		{
+			name:        "failing primary starts backup at once",
+			attempts:    []fakeAttempt{{err: errDown}, {}},
+			wantIndex:   1,
+			wantStarted: 2,
+			maxDuration: 40 * time.Millisecond,
+		},
+		{
+			name:        "all fail with primary error",
+			attempts:    []fakeAttempt{{err: errDown}, {err: errors.New("also down")}},
+			wantErr:     errDown,
+			wantStarted: 2,
+		},
+		{
+			name:        "certificate mismatch is reported first",
+			attempts:    []fakeAttempt{{err: errDown}, {err: mismatch}},
+			wantErr:     ErrFingerprintMismatch,
+			wantStarted: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoints := make([]Endpoint, len(tt.attempts))
+			for i := range endpoints {
+				endpoints[i] = Endpoint{Host: "host", Port: string(rune('1' + i))}
+			}
+			var (
+				mu      sync.Mutex
+				started int
+			)
+			dial := func(ctx context.Context, e Endpoint) (net.Conn, tls.ConnectionState, error) {
+				mu.Lock()
+				started++
+				mu.Unlock()
+				a := tt.attempts[e.Port[0]-'1']
+				select {
+				case <-time.After(a.after):
+				case <-ctx.Done():
+					return nil, tls.ConnectionState{}, ctx.Err()
+				}
+				if a.err != nil {
+					return nil, tls.ConnectionState{}, a.err
+				}
+				client, server := net.Pipe()
+				server.Close()
+				return client, tls.ConnectionState{}, nil
+			}
+
+			begin := time.Now()
+			conn, _, index, err := raceEndpoints(context.Background(), endpoints, 50*time.Millisecond, dial)
+			elapsed := time.Since(begin)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("raceEndpoints() error = %v, want %v", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("raceEndpoints() error = %v", err)
+				}
+				conn.Close()
+				if index != tt.wantIndex {
+					t.Errorf("raceEndpoints() index = %d, want %d", index, tt.wantIndex)
+				}
+			}
+			if tt.maxDuration > 0 && elapsed > tt.maxDuration {
+				t.Errorf("raceEndpoints() took %v, want at most %v", elapsed, tt.maxDuration)
+			}
+
+			time.Sleep(60 * time.Millisecond) // no attempts start after the race
+			mu.Lock()
+			defer mu.Unlock()
+			if started != tt.wantStarted {
+				t.Errorf("started %d attempts, want %d", started, tt.wantStarted)
+			}
+		})
+	}
+}
+
+// unusedAddr returns a loopback address nothing listens on.
+func unusedAddr(t *testing.T) Endpoint {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	e, err := ParseEndpoint(addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestDialFailover(t *testing.T) {
+	srv := newTestServer(t, true)
+	backup, err := ParseEndpoint(srv.addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := unusedAddr(t)
+
+	opts := srv.options(t)
+	opts.Endpoints = []Endpoint{primary, backup}
+	session, err := Dial(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer session.Close()
+	srv.accept(t)
+
+	if session.Endpoint() != backup || !session.Fallback() {
+		t.Errorf("Endpoint() = %v, Fallback() = %v, want %v, true", session.Endpoint(), session.Fallback(), backup)
+	}
+	if err := Probe(context.Background(), opts, primary); err == nil || !Retryable(err) {
+		t.Errorf("Probe(primary) error = %v, want a retryable error", err)
+	}
+	if err := Probe(context.Background(), opts, backup); err != nil {
+		t.Errorf("Probe(backup) error = %v", err)
+	}
+
+	opts.Config.ExpectedFP = strings.Repeat("0", 64)
+	if err := Probe(context.Background(), opts, backup); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("Probe() with wrong pin error = %v, want %v", err, ErrFingerprintMismatch)
+	}
+	cert, err := FetchCertificate(context.Background(), opts, backup)
+	if err != nil {
+		t.Fatalf("FetchCertificate() error = %v", err)
+	}
+	if got := protocol.CertFingerprint(cert); got != srv.fingerprint {
+		t.Errorf("FetchCertificate() fingerprint = %s, want %s", got, srv.fingerprint)
+	}
+	if _, err := FetchCertificate(context.Background(), opts, primary); err == nil || !Retryable(err) {
+		t.Errorf("FetchCertificate(primary) error = %v, want a retryable error", err)
+	}
+}
+
+func TestDialIPv6(t *testing.T) {
+	cert, fp := newTestCert(t)
+	ln, err := tls.Listen("tcp", "[::1]:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	srv := &testServer{addr: ln.Addr().String(), fingerprint: fp, allow: true, conns: make(chan *serverConn, 4)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			srv.handle(t, conn)
+		}
+	}()
+
+	opts := srv.options(t)
+	if opts.Host != "::1" {
+		t.Fatalf("Host = %q, want %q", opts.Host, "::1")
+	}
+	session, err := Dial(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer session.Close()
+	srv.accept(t)
+	if got := session.Addr(); got != srv.addr {
+		t.Errorf("Addr() = %q, want %q", got, srv.addr)
+	}
+}
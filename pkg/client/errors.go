@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"silent_chat/pkg/protocol"
+)
+
+var (
+	// ErrAuthFailed is returned by Dial when the server rejects the
+	// password. The server's reason follows in the error text.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrResumeRejected is returned by Dial when the server does not accept
+	// Options.ResumeToken. The caller should retry with the password.
+	ErrResumeRejected = errors.New("resume token rejected")
+	// ErrFingerprintMismatch is returned by Dial when the server certificate
+	// does not match Config.ExpectedFP.
+	ErrFingerprintMismatch = protocol.ErrFingerprintMismatch
+	// ErrPacketTooLarge is returned for frames above the configured limits.
+	ErrPacketTooLarge = protocol.ErrPacketTooLarge
+	// ErrProtocol is returned when the server sends something the client
+	// does not understand, such as a malformed frame or an unexpected reply.
+	ErrProtocol = errors.New("protocol error")
+)
+
+// NetworkError reports a failure of the underlying connection, such as a
+// failed dial, a reset connection or an expired deadline.
+type NetworkError struct {
+	Op  string // operation that failed, e.g. "dial" or "read header"
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether connecting again may succeed after err.
+// Rejected credentials and a wrong server certificate will not fix
+// themselves, and a cancelled context means the caller gave up; everything
+// else, including network and protocol errors, is worth another attempt.
+func Retryable(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrAuthFailed),
+		errors.Is(err, ErrFingerprintMismatch),
+		errors.Is(err, context.Canceled):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"silent_chat/pkg/config"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "auth failed", err: fmt.Errorf("%w: bad password", ErrAuthFailed), want: false},
+		{name: "fingerprint mismatch", err: ErrFingerprintMismatch, want: false},
+		{name: "cancelled", err: fmt.Errorf("authentication cancelled: %w", context.Canceled), want: false},
+		{name: "network", err: &NetworkError{Op: "dial", Err: errors.New("connection refused")}, want: true},
+		{name: "resume rejected", err: ErrResumeRejected, want: true},
+		{name: "protocol", err: fmt.Errorf("%w: unexpected response from server", ErrProtocol), want: true},
+		{name: "packet too large", err: ErrPacketTooLarge, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrameReaderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		close   bool
+		wantIs  error
+		wantNet bool
+	}{
+		{name: "zero size", data: []byte{0, 0, 0, 0}, wantIs: ErrProtocol},
+		{name: "too large", data: []byte{0xff, 0, 0, 0}, wantIs: ErrPacketTooLarge},
+		{name: "peer closed", data: []byte{0, 0}, close: true, wantIs: io.EOF, wantNet: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer local.Close()
+			go func() {
+				remote.Write(tt.data)
+				if tt.close {
+					remote.Close()
+				}
+			}()
+			defer remote.Close()
+
+			local.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, err := newFrameReader(local, config.NewConfig()).next()
+			if !errors.Is(err, tt.wantIs) {
+				t.Errorf("next() error = %v, want %v", err, tt.wantIs)
+			}
+			var netErr *NetworkError
+			if errors.As(err, &netErr) != tt.wantNet {
+				t.Errorf("next() error = %v, NetworkError = %v, want %v", err, !tt.wantNet, tt.wantNet)
+			}
+		})
+	}
+}
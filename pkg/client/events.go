@@ -0,0 +1,33 @@
+package client
+
+import "silent_chat/pkg/protocol"
+
+// Event is delivered on Session.Events. It is one of MessageEvent,
+// StateEvent or ErrorEvent.
+type Event interface {
+	isEvent()
+}
+
+// MessageEvent carries a frame received from the server. Warnings holds
+// transcript chain problems detected for chat messages.
+type MessageEvent struct {
+	Message  protocol.Message
+	Warnings []string
+}
+
+// StateEvent reports a change of the session state: StateReady when the
+// session starts and StateDisconnected when it ends, with the cause in Err.
+type StateEvent struct {
+	State State
+	Err   error
+}
+
+// ErrorEvent reports a non-fatal error, such as a rejected replayed frame.
+// The session keeps running after an ErrorEvent.
+type ErrorEvent struct {
+	Err error
+}
+
+func (MessageEvent) isEvent() {}
+func (StateEvent) isEvent()   {}
+func (ErrorEvent) isEvent()   {}
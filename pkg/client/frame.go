@@ -0,0 +1,77 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"silent_chat/pkg/config"
+)
+
+// frameReader reads length-prefixed frames from a connection. It keeps the
+// bytes of a partially received frame across calls, so a read that times
+// out can be retried without losing framing.
+type frameReader struct {
+	conn   net.Conn
+	config *config.Config
+
+	header [4]byte
+	nhead  int    // header bytes received so far
+	body   []byte // allocated once the header is complete
+	nbody  int    // body bytes received so far
+}
+
+func newFrameReader(conn net.Conn, cfg *config.Config) *frameReader {
+	return &frameReader{conn: conn, config: cfg}
+}
+
+// next returns the body of the next frame. If the read deadline expires
+// mid-frame, next returns the timeout error and resumes the same frame on
+// the following call. Any other error leaves the stream unusable.
+func (r *frameReader) next() ([]byte, error) {
+	for r.nhead < len(r.header) {
+		n, err := r.conn.Read(r.header[r.nhead:])
+		r.nhead += n
+		if err != nil {
+			return nil, &NetworkError{Op: "read header", Err: err}
+		}
+	}
+
+	if r.body == nil {
+		size := binary.BigEndian.Uint32(r.header[:])
+		if size == 0 {
+			return nil, fmt.Errorf("%w: packet size is zero", ErrProtocol)
+		}
+		if size > r.config.MaxPacketSize {
+			return nil, fmt.Errorf("%w: %d bytes", ErrPacketTooLarge, size)
+		}
+		if size > r.config.AbsoluteMaxPacketSize {
+			return nil, fmt.Errorf(
+				"%w: %d bytes, attack detected",
+				ErrPacketTooLarge,
+				size,
+			)
+		}
+		r.body = make([]byte, size)
+	}
+
+	for r.nbody < len(r.body) {
+		n, err := r.conn.Read(r.body[r.nbody:])
+		r.nbody += n
+		if err != nil {
+			return nil, &NetworkError{Op: "read body", Err: err}
+		}
+	}
+
+	body := r.body
+	r.nhead, r.body, r.nbody = 0, nil, 0
+	return body, nil
+}
+
+// isTimeout reports whether err is or wraps a network timeout, such as an
+// expired read deadline.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
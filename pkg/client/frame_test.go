@@ -0,0 +1,147 @@
+package client
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"silent_chat/pkg/config"
+	"silent_chat/pkg/protocol"
+)
+
+// newPipeSession returns a session over net.Pipe whose writer is running,
+// and a serverConn for the other end. Reading is left to the test.
+func newPipeSession(t *testing.T, cfg *config.Config) (*Session, *serverConn) {
+	t.Helper()
+	local, remote := net.Pipe()
+	s := newSession(local, "pipe", "alice", cfg, NewMachine())
+	s.setNonce("nonce")
+	s.ownsMachine = true
+	go s.writeLoop()
+	t.Cleanup(func() {
+		s.Close()
+		remote.Close()
+	})
+	return s, &serverConn{t: t, conn: remote, nonce: "nonce"}
+}
+
+// writeChunked writes data in pieces of the given size, pausing between
+// them to simulate a slow or stalled peer.
+func writeChunked(t *testing.T, conn net.Conn, data []byte, chunk int, pause time.Duration) {
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		if _, err := conn.Write(data[:n]); err != nil {
+			t.Errorf("peer write: %v", err)
+			return
+		}
+		data = data[n:]
+		time.Sleep(pause)
+	}
+}
+
+func encodeFrame(t *testing.T, msg protocol.Message) []byte {
+	t.Helper()
+	data, err := protocol.EncodeMessage(msg, config.NewConfig())
+	if err != nil {
+		t.Fatalf("EncodeMessage() error = %v", err)
+	}
+	return data
+}
+
+func TestFrameReaderResumesAfterTimeout(t *testing.T) {
+	first := encodeFrame(t, protocol.Message{Type: "chat", Text: "first"})
+	second := encodeFrame(t, protocol.Message{Type: "chat", Text: "second"})
+
+	tests := []struct {
+		name  string
+		write func(t *testing.T, conn net.Conn)
+	}{
+		{
+			name: "slow peer",
+			write: func(t *testing.T, conn net.Conn) {
+				writeChunked(t, conn, append(append([]byte{}, first...), second...), 3, 15*time.Millisecond)
+			},
+		},
+		{
+			name: "stalled mid header",
+			write: func(t *testing.T, conn net.Conn) {
+				writeChunked(t, conn, first[:2], 2, 60*time.Millisecond)
+				writeChunked(t, conn, append(append([]byte{}, first[2:]...), second...), len(first)+len(second), 0)
+			},
+		},
+		{
+			name: "stalled mid body",
+			write: func(t *testing.T, conn net.Conn) {
+				writeChunked(t, conn, first[:10], 10, 60*time.Millisecond)
+				writeChunked(t, conn, append(append([]byte{}, first[10:]...), second...), len(first)+len(second), 0)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer local.Close()
+			defer remote.Close()
+			go tt.write(t, remote)
+
+			r := newFrameReader(local, config.NewConfig())
+			var got [][]byte
+			timeouts := 0
+			deadline := time.Now().Add(5 * time.Second)
+			for len(got) < 2 && time.Now().Before(deadline) {
+				local.SetReadDeadline(time.Now().Add(5 * time.Millisecond))
+				body, err := r.next()
+				if isTimeout(err) {
+					timeouts++
+					continue
+				}
+				if err != nil {
+					t.Fatalf("next() error = %v", err)
+				}
+				got = append(got, body)
+			}
+
+			if len(got) != 2 {
+				t.Fatalf("read %d frames, want 2", len(got))
+			}
+			if !bytes.Equal(got[0], first[4:]) || !bytes.Equal(got[1], second[4:]) {
+				t.Errorf("frames = %q, %q", got[0], got[1])
+			}
+			if timeouts == 0 {
+				t.Error("peer was never slow enough to hit the read deadline")
+			}
+		})
+	}
+}
+
+func TestReadLoopSurvivesStalledPeer(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.ReadTimeout = 10 * time.Millisecond
+	s, sc := newPipeSession(t, cfg)
+	go s.readLoop()
+
+	sc.seq++
+	frame := encodeFrame(t, protocol.Message{
+		Type: "chat", ID: "1", Text: "hello", SenderName: "bob",
+		Nonce: sc.nonce, Seq: sc.seq,
+	})
+	go writeChunked(t, sc.conn, frame, 5, 25*time.Millisecond)
+
+	ev := nextEvent[MessageEvent](t, s)
+	if ev.Message.Text != "hello" || ev.Message.SenderName != "bob" {
+		t.Errorf("received %+v", ev.Message)
+	}
+
+	select {
+	case <-s.Done():
+		t.Fatal("session closed by a slow peer")
+	default:
+	}
+
+	sc.conn.Close()
+	if state := nextEvent[StateEvent](t, s); state.State != StateDisconnected {
+		t.Errorf("state = %v, want %v", state.State, StateDisconnected)
+	}
+}
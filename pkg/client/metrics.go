@@ -0,0 +1,232 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Frame classes used to break down traffic in Metrics.
+const (
+	ClassChat    = "chat"
+	ClassFake    = "fake"
+	ClassControl = "control"
+)
+
+var frameClasses = []string{ClassChat, ClassFake, ClassControl}
+
+// frameClass returns the traffic class of a frame type.
+func frameClass(typ string) string {
+	switch typ {
+	case "chat":
+		return ClassChat
+	case "fake":
+		return ClassFake
+	default:
+		return ClassControl
+	}
+}
+
+// Metrics counts connection and traffic events. One Metrics is usually
+// shared by all sessions of a client through Options.Metrics, so counters
+// survive reconnects. It is safe for concurrent use, and all methods are
+// no-ops on a nil *Metrics.
+type Metrics struct {
+	dials        atomic.Uint64
+	dialFailures atomic.Uint64
+	authFailures atomic.Uint64
+	connects     atomic.Uint64
+	reconnects   atomic.Uint64
+
+	sent     [3]trafficCounter
+	received [3]trafficCounter
+
+	queueDepth    atomic.Int64
+	maxQueueDepth atomic.Int64
+
+	rttLast  atomic.Int64 // nanoseconds
+	rttSum   atomic.Int64 // nanoseconds
+	rttCount atomic.Uint64
+}
+
+type trafficCounter struct {
+	frames atomic.Uint64
+	bytes  atomic.Uint64
+}
+
+// NewMetrics returns a zeroed Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+func classIndex(class string) int {
+	for i, c := range frameClasses {
+		if c == class {
+			return i
+		}
+	}
+	return len(frameClasses) - 1
+}
+
+func (m *Metrics) frameSent(typ string, n int) {
+	if m == nil {
+		return
+	}
+	c := &m.sent[classIndex(frameClass(typ))]
+	c.frames.Add(1)
+	c.bytes.Add(uint64(n))
+}
+
+func (m *Metrics) frameReceived(typ string, n int) {
+	if m == nil {
+		return
+	}
+	c := &m.received[classIndex(frameClass(typ))]
+	c.frames.Add(1)
+	c.bytes.Add(uint64(n))
+}
+
+func (m *Metrics) dialStarted() {
+	if m == nil {
+		return
+	}
+	m.dials.Add(1)
+}
+
+func (m *Metrics) dialFailed(err error) {
+	if m == nil {
+		return
+	}
+	m.dialFailures.Add(1)
+	if isAuthFailure(err) {
+		m.authFailures.Add(1)
+	}
+}
+
+func (m *Metrics) connected() {
+	if m == nil {
+		return
+	}
+	if m.connects.Add(1) > 1 {
+		m.reconnects.Add(1)
+	}
+}
+
+func (m *Metrics) observeRTT(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.rttLast.Store(int64(d))
+	m.rttSum.Add(int64(d))
+	m.rttCount.Add(1)
+}
+
+func (m *Metrics) queueChanged(delta int64) {
+	if m == nil {
+		return
+	}
+	depth := m.queueDepth.Add(delta)
+	for {
+		peak := m.maxQueueDepth.Load()
+		if depth <= peak || m.maxQueueDepth.CompareAndSwap(peak, depth) {
+			return
+		}
+	}
+}
+
+func isAuthFailure(err error) bool {
+	return errors.Is(err, ErrAuthFailed) || errors.Is(err, ErrResumeRejected)
+}
+
+// Traffic is the number of frames and bytes of one class in one direction.
+// Bytes include the 4-byte length prefix.
+type Traffic struct {
+	Frames uint64
+	Bytes  uint64
+}
+
+// MetricsSnapshot is a point-in-time copy of Metrics.
+type MetricsSnapshot struct {
+	Dials         uint64
+	DialFailures  uint64
+	AuthFailures  uint64
+	Connects      uint64
+	Reconnects    uint64
+	Sent          map[string]Traffic // by frame class
+	Received      map[string]Traffic // by frame class
+	QueueDepth    int64
+	MaxQueueDepth int64
+	LastRTT       time.Duration // authentication round trip of the latest session
+	AvgRTT        time.Duration
+}
+
+// Snapshot returns the current values.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	s := MetricsSnapshot{
+		Sent:     make(map[string]Traffic, len(frameClasses)),
+		Received: make(map[string]Traffic, len(frameClasses)),
+	}
+	if m == nil {
+		return s
+	}
+
+	s.Dials = m.dials.Load()
+	s.DialFailures = m.dialFailures.Load()
+	s.AuthFailures = m.authFailures.Load()
+	s.Connects = m.connects.Load()
+	s.Reconnects = m.reconnects.Load()
+	for i, class := range frameClasses {
+		s.Sent[class] = Traffic{Frames: m.sent[i].frames.Load(), Bytes: m.sent[i].bytes.Load()}
+		s.Received[class] = Traffic{Frames: m.received[i].frames.Load(), Bytes: m.received[i].bytes.Load()}
+	}
+	s.QueueDepth = m.queueDepth.Load()
+	s.MaxQueueDepth = m.maxQueueDepth.Load()
+	s.LastRTT = time.Duration(m.rttLast.Load())
+	if n := m.rttCount.Load(); n > 0 {
+		s.AvgRTT = time.Duration(m.rttSum.Load() / int64(n))
+	}
+	return s
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	s := m.Snapshot()
+	var err error
+	p := func(format string, args ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	counter := func(name, help string, v uint64) {
+		p("# HELP silent_chat_%s %s\n# TYPE silent_chat_%s counter\nsilent_chat_%s %d\n", name, help, name, name, v)
+	}
+	counter("dials_total", "Connection attempts.", s.Dials)
+	counter("dial_failures_total", "Connection attempts that failed, including authentication.", s.DialFailures)
+	counter("auth_failures_total", "Connection attempts rejected by the server.", s.AuthFailures)
+	counter("connects_total", "Sessions established.", s.Connects)
+	counter("reconnects_total", "Sessions established after the first one.", s.Reconnects)
+
+	traffic := func(name, help string, byClass map[string]Traffic, bytes bool) {
+		p("# HELP silent_chat_%s %s\n# TYPE silent_chat_%s counter\n", name, help, name)
+		for _, class := range frameClasses {
+			v := byClass[class].Frames
+			if bytes {
+				v = byClass[class].Bytes
+			}
+			p("silent_chat_%s{class=%q} %d\n", name, class, v)
+		}
+	}
+	traffic("frames_sent_total", "Frames written, by class.", s.Sent, false)
+	traffic("bytes_sent_total", "Bytes written including framing, by class.", s.Sent, true)
+	traffic("frames_received_total", "Frames read, by class.", s.Received, false)
+	traffic("bytes_received_total", "Bytes read including framing, by class.", s.Received, true)
+
+	p("# HELP silent_chat_send_queue_depth Frames waiting for the writer.\n# TYPE silent_chat_send_queue_depth gauge\nsilent_chat_send_queue_depth %d\n", s.QueueDepth)
+	p("# HELP silent_chat_send_queue_depth_max Highest send queue depth seen.\n# TYPE silent_chat_send_queue_depth_max gauge\nsilent_chat_send_queue_depth_max %d\n", s.MaxQueueDepth)
+	p("# HELP silent_chat_rtt_seconds Authentication round trip of the latest session.\n# TYPE silent_chat_rtt_seconds gauge\nsilent_chat_rtt_seconds %g\n", s.LastRTT.Seconds())
+	p("# HELP silent_chat_rtt_avg_seconds Mean authentication round trip.\n# TYPE silent_chat_rtt_avg_seconds gauge\nsilent_chat_rtt_avg_seconds %g\n", s.AvgRTT.Seconds())
+	return err
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// MetricsServer serves Metrics in the Prometheus text format at /metrics.
+// It only ever listens on a loopback address, so the counters are not
+// exposed to the network.
+type MetricsServer struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// ListenMetrics starts serving m on addr, which must name a loopback host
+// such as "127.0.0.1:9464" or "localhost:9464".
+func ListenMetrics(addr string, m *Metrics) (*MetricsServer, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metrics address: %v", err)
+	}
+	if !isLoopback(host) {
+		return nil, fmt.Errorf("metrics address %q is not a loopback address", addr)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := m.WritePrometheus(w); err != nil {
+			slog.Debug("write metrics", "err", err)
+		}
+	})
+
+	s := &MetricsServer{
+		server:   &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second},
+		listener: ln,
+	}
+	go func() {
+		if err := s.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("metrics server stopped", "err", err)
+		}
+	}()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *MetricsServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server.
+func (s *MetricsServer) Close() error {
+	return s.server.Close()
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"silent_chat/pkg/config"
+	"silent_chat/pkg/protocol"
+)
+
+func TestMetricsCountTrafficByClass(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.SendJitter = 0
+	s, sc := newPipeSession(t, cfg)
+	m := NewMetrics()
+	s.metrics = m
+	go s.readLoop()
+
+	ctx := context.Background()
+	for _, msg := range []protocol.Message{
+		{Type: "chat", Text: "hi"},
+		{Type: "fake", Text: "xx"},
+		{Type: "timer", TTL: 60},
+	} {
+		read := make(chan struct{})
+		go func() {
+			defer close(read)
+			sc.readType(msg.Type)
+		}()
+		if err := s.Send(ctx, msg); err != nil {
+			t.Fatalf("Send(%s) error = %v", msg.Type, err)
+		}
+		<-read
+	}
+
+	sc.write(protocol.Message{Type: "chat", ID: "1", Text: "hello", SenderName: "bob"})
+	nextEvent[MessageEvent](t, s)
+
+	snap := m.Snapshot()
+	for _, class := range []string{ClassChat, ClassFake, ClassControl} {
+		if got := snap.Sent[class]; got.Frames != 1 || got.Bytes == 0 {
+			t.Errorf("Sent[%s] = %+v, want one frame", class, got)
+		}
+	}
+	if got := snap.Received[ClassChat]; got.Frames != 1 || got.Bytes == 0 {
+		t.Errorf("Received[chat] = %+v, want one frame", got)
+	}
+	if snap.QueueDepth != 0 || snap.MaxQueueDepth < 1 {
+		t.Errorf("queue depth = %d (max %d), want 0 (max >= 1)", snap.QueueDepth, snap.MaxQueueDepth)
+	}
+}
+
+func TestMetricsConnections(t *testing.T) {
+	m := NewMetrics()
+	m.dialStarted()
+	m.dialFailed(&NetworkError{Op: "dial", Err: errors.New("refused")})
+	m.dialStarted()
+	m.dialFailed(fmt.Errorf("%w: bad password", ErrAuthFailed))
+	for i := 0; i < 3; i++ {
+		m.dialStarted()
+		m.observeRTT(time.Duration(i+1) * 10 * time.Millisecond)
+		m.connected()
+	}
+
+	snap := m.Snapshot()
+	if snap.Dials != 5 || snap.DialFailures != 2 || snap.AuthFailures != 1 {
+		t.Errorf("dials = %d, failures = %d, auth failures = %d, want 5, 2, 1",
+			snap.Dials, snap.DialFailures, snap.AuthFailures)
+	}
+	if snap.Connects != 3 || snap.Reconnects != 2 {
+		t.Errorf("connects = %d, reconnects = %d, want 3, 2", snap.Connects, snap.Reconnects)
+	}
+	if snap.LastRTT != 30*time.Millisecond || snap.AvgRTT != 20*time.Millisecond {
+		t.Errorf("rtt = %v, avg %v, want 30ms, 20ms", snap.LastRTT, snap.AvgRTT)
+	}
+
+	var nilMetrics *Metrics
+	nilMetrics.connected()
+	if got := nilMetrics.Snapshot(); got.Connects != 0 {
+		t.Errorf("nil Metrics snapshot = %+v", got)
+	}
+}
+
+func TestListenMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		wantErr bool
+	}{
+		{name: "loopback", addr: "127.0.0.1:0"},
+		{name: "all interfaces", addr: ":0", wantErr: true},
+		{name: "unspecified", addr: "0.0.0.0:0", wantErr: true},
+		{name: "not host port", addr: "localhost", wantErr: true},
+	}
+
+	m := NewMetrics()
+	m.dialStarted()
+	m.connected()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := ListenMetrics(tt.addr, m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListenMetrics(%q) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer srv.Close()
+
+			resp, err := http.Get("http://" + srv.Addr() + "/metrics")
+			if err != nil {
+				t.Fatalf("GET /metrics: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			for _, want := range []string{
+				"silent_chat_connects_total 1",
+				`silent_chat_frames_sent_total{class="fake"} 0`,
+				"# TYPE silent_chat_rtt_seconds gauge",
+			} {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("metrics output lacks %q:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"silent_chat/internal/secret"
+	"silent_chat/internal/utils"
+	"silent_chat/pkg/protocol"
+)
+
+// The outbox file is the magic and the key derivation parameters, followed
+// by the JSON queue sealed with package secret. The header is authenticated
+// as additional data.
+const (
+	outboxMagic      = "SCOUTB01"
+	outboxHeaderSize = len(outboxMagic) + secret.ParamsSize
+)
+
+// ErrOutboxPassphrase is returned by NewOutbox when the passphrase does not
+// decrypt the outbox file.
+var ErrOutboxPassphrase = errors.New("wrong passphrase or corrupted outbox")
+
+// Outbox queues outgoing messages that could not be delivered yet, for
+// example while disconnected or after a write failure, and sends them in
+// order once a session is available again. Messages are identified by ID,
+// so queueing the same message twice has no effect.
+//
+// If the outbox has a path, the queue is kept in that file so pending
+// messages survive a restart. The file has mode 0600 and is encrypted with
+// a key derived from a passphrase.
+type Outbox struct {
+	path   string
+	header []byte
+	aead   cipher.AEAD
+
+	mu   sync.Mutex
+	msgs []protocol.Message
+
+	// flushMu serialises Flush so messages are never sent out of order.
+	flushMu sync.Mutex
+}
+
+// NewOutbox returns an outbox stored at path, loading any messages queued
+// by a previous run and decrypting them with a key derived from passphrase.
+// An empty path keeps the queue in memory only and ignores passphrase. The
+// caller may wipe passphrase after NewOutbox returns.
+func NewOutbox(path string, passphrase []byte) (*Outbox, error) {
+	o := &Outbox{path: path}
+	if path == "" {
+		return o, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || err == nil && len(data) == 0 {
+		params, err := secret.NewParams()
+		if err != nil {
+			return nil, err
+		}
+		o.header = append([]byte(outboxMagic), params.Marshal()...)
+		if o.aead, err = params.AEAD(passphrase); err != nil {
+			return nil, err
+		}
+		return o, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %v", err)
+	}
+
+	if len(data) < outboxHeaderSize || !bytes.HasPrefix(data, []byte(outboxMagic)) {
+		return nil, fmt.Errorf("not an outbox file")
+	}
+	o.header = data[:outboxHeaderSize]
+	params, err := secret.ParseParams(o.header[len(outboxMagic):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid outbox header: %w", err)
+	}
+	if o.aead, err = params.AEAD(passphrase); err != nil {
+		return nil, err
+	}
+	plain, err := secret.Open(o.aead, data[outboxHeaderSize:], o.header)
+	if err != nil {
+		return nil, ErrOutboxPassphrase
+	}
+	if err := json.Unmarshal(plain, &o.msgs); err != nil {
+		return nil, fmt.Errorf("failed to parse outbox: %v", err)
+	}
+	return o, nil
+}
+
+// Add queues msg. A message without an ID gets a random one. It reports
+// false if a message with the same ID is already queued.
+func (o *Outbox) Add(msg protocol.Message) (bool, error) {
+	if msg.ID == "" {
+		id, err := utils.RandomString(16)
+		if err != nil {
+			return false, fmt.Errorf("failed to generate message id: %v", err)
+		}
+		msg.ID = id
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, queued := range o.msgs {
+		if queued.ID == msg.ID {
+			return false, nil
+		}
+	}
+	o.msgs = append(o.msgs, msg)
+	return true, o.save()
+}
+
+// Pending returns a copy of the queued messages in send order.
+func (o *Outbox) Pending() []protocol.Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]protocol.Message(nil), o.msgs...)
+}
+
+// Contains reports whether a message with the given ID is queued.
+func (o *Outbox) Contains(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, msg := range o.msgs {
+		if msg.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of queued messages.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.msgs)
+}
+
+// Flush sends the queued messages in order with send, typically
+// Session.Send, removing each one once it is written. It stops at the first
+// error and returns the IDs delivered so far together with that error.
+func (o *Outbox) Flush(ctx context.Context, send func(context.Context, protocol.Message) error) ([]string, error) {
+	o.flushMu.Lock()
+	defer o.flushMu.Unlock()
+
+	var sent []string
+	for {
+		o.mu.Lock()
+		if len(o.msgs) == 0 {
+			o.mu.Unlock()
+			return sent, nil
+		}
+		msg := o.msgs[0]
+		o.mu.Unlock()
+
+		if err := send(ctx, msg); err != nil {
+			return sent, err
+		}
+
+		o.mu.Lock()
+		if len(o.msgs) > 0 && o.msgs[0].ID == msg.ID {
+			o.msgs = o.msgs[1:]
+		}
+		err := o.save()
+		o.mu.Unlock()
+
+		sent = append(sent, msg.ID)
+		if err != nil {
+			return sent, err
+		}
+	}
+}
+
+// Clear drops all queued messages and securely deletes the outbox file.
+func (o *Outbox) Clear() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.msgs = nil
+	if o.path == "" {
+		return nil
+	}
+	if _, err := os.Stat(o.path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return utils.SecureDelete(o.path)
+}
+
+// save seals the queue and writes it to disk through a temporary file so a
+// crash never leaves a truncated outbox. The caller must hold o.mu.
+func (o *Outbox) save() error {
+	if o.path == "" {
+		return nil
+	}
+
+	plain, err := json.Marshal(o.msgs)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox: %v", err)
+	}
+	sealed, err := secret.Seal(o.aead, plain, o.header)
+	if err != nil {
+		return err
+	}
+	data := append(append([]byte(nil), o.header...), sealed...)
+
+	tmp, err := os.CreateTemp(filepath.Dir(o.path), filepath.Base(o.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write outbox: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write outbox: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write outbox: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write outbox: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), o.path); err != nil {
+		return fmt.Errorf("failed to write outbox: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"silent_chat/internal/secret"
+	"silent_chat/pkg/protocol"
+)
+
+var testPassphrase = []byte("correct horse battery staple")
+
+func TestOutboxAddDeduplicates(t *testing.T) {
+	o, err := NewOutbox("", nil)
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		msg   protocol.Message
+		added bool
+	}{
+		{name: "first", msg: protocol.Message{Type: "chat", ID: "a", Text: "one"}, added: true},
+		{name: "second", msg: protocol.Message{Type: "chat", ID: "b", Text: "two"}, added: true},
+		{name: "duplicate ID", msg: protocol.Message{Type: "chat", ID: "a", Text: "again"}, added: false},
+		{name: "generated ID", msg: protocol.Message{Type: "chat", Text: "three"}, added: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, err := o.Add(tt.msg)
+			if err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			if added != tt.added {
+				t.Errorf("Add() = %v, want %v", added, tt.added)
+			}
+		})
+	}
+
+	pending := o.Pending()
+	if len(pending) != 3 || pending[0].Text != "one" || pending[1].Text != "two" || pending[2].ID == "" {
+		t.Errorf("Pending() = %+v", pending)
+	}
+}
+
+func TestOutboxFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	o, err := NewOutbox(path, testPassphrase)
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if _, err := o.Add(protocol.Message{Type: "chat", ID: id, Text: "msg " + id}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	errDown := errors.New("connection down")
+	var got []string
+	failing := func(_ context.Context, msg protocol.Message) error {
+		if msg.ID == "2" {
+			return errDown
+		}
+		got = append(got, msg.ID)
+		return nil
+	}
+	sent, err := o.Flush(context.Background(), failing)
+	if !errors.Is(err, errDown) {
+		t.Fatalf("Flush() error = %v, want %v", err, errDown)
+	}
+	if !reflect.DeepEqual(sent, []string{"1"}) {
+		t.Errorf("Flush() sent = %v, want [1]", sent)
+	}
+
+	reloaded, err := NewOutbox(path, testPassphrase)
+	if err != nil {
+		t.Fatalf("NewOutbox() reload error = %v", err)
+	}
+	if reloaded.Len() != 2 || !reloaded.Contains("2") || !reloaded.Contains("3") {
+		t.Fatalf("reloaded outbox = %+v", reloaded.Pending())
+	}
+
+	got = nil
+	ok := func(_ context.Context, msg protocol.Message) error {
+		got = append(got, msg.ID)
+		return nil
+	}
+	if _, err := reloaded.Flush(context.Background(), ok); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"2", "3"}) {
+		t.Errorf("flushed %v, want [2 3]", got)
+	}
+	if reloaded.Len() != 0 {
+		t.Errorf("Len() = %d after flush, want 0", reloaded.Len())
+	}
+
+	if err := reloaded.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	empty, err := NewOutbox(path, testPassphrase)
+	if err != nil || empty.Len() != 0 {
+		t.Errorf("outbox after Clear() = %v, %v", empty.Pending(), err)
+	}
+}
+
+func TestOutboxFileIsEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.bin")
+	o, err := NewOutbox(path, testPassphrase)
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+	if _, err := o.Add(protocol.Message{Type: "chat", ID: "1", Text: "meet at noon"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("meet at noon")) {
+		t.Error("outbox file contains the message in plain text")
+	}
+
+	if _, err := NewOutbox(path, []byte("wrong")); !errors.Is(err, ErrOutboxPassphrase) {
+		t.Errorf("NewOutbox() with wrong passphrase error = %v, want %v", err, ErrOutboxPassphrase)
+	}
+
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewOutbox(path, testPassphrase); !errors.Is(err, ErrOutboxPassphrase) {
+		t.Errorf("NewOutbox() of tampered file error = %v, want %v", err, ErrOutboxPassphrase)
+	}
+}
+
+func TestOutboxCorruptedHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.bin")
+	o, err := NewOutbox(path, testPassphrase)
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+	if _, err := o.Add(protocol.Message{Type: "chat", ID: "1", Text: "hello"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last header byte is the Argon2 thread count; zero made argon2 panic.
+	data[outboxHeaderSize-1] = 0
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewOutbox(path, testPassphrase); !errors.Is(err, secret.ErrInvalidParams) {
+		t.Errorf("NewOutbox() error = %v, want %v", err, secret.ErrInvalidParams)
+	}
+}
@@ -0,0 +1,316 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"silent_chat/internal/utils"
+)
+
+// ContextDialer opens the TCP connection a transport runs over.
+// *net.Dialer and *ProxyDialer implement it.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// ErrProxy is returned when the proxy refuses or fails to open a connection.
+var ErrProxy = errors.New("proxy error")
+
+// ProxyDialer connects through a proxy. The URL scheme selects the protocol:
+//
+//   - socks5:// resolves the server name locally and sends the address
+//   - socks5h:// lets the proxy resolve the name, as Tor requires
+//   - http:// uses an HTTP CONNECT tunnel
+//
+// Credentials in the URL are sent to the proxy (SOCKS username/password or
+// HTTP basic authentication).
+type ProxyDialer struct {
+	URL *url.URL
+	// Isolate sends fresh random SOCKS credentials on every connection if
+	// URL has none, so Tor routes each session over a separate circuit.
+	Isolate bool
+	// Forward opens the connection to the proxy itself. If nil, a
+	// *net.Dialer is used.
+	Forward ContextDialer
+}
+
+// NewProxyDialer parses rawURL and returns a dialer for it. Missing ports
+// default to 1080 for SOCKS and 80 for HTTP proxies.
+func NewProxyDialer(rawURL string, isolate bool) (*ProxyDialer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", u.Redacted())
+	}
+
+	var port string
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		port = "1080"
+	case "http":
+		if isolate {
+			return nil, fmt.Errorf("proxy isolation requires a SOCKS proxy")
+		}
+		port = "80"
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return &ProxyDialer{URL: u, Isolate: isolate}, nil
+}
+
+// DialContext connects to addr through the proxy.
+func (d *ProxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("proxy: unsupported network %q", network)
+	}
+	forward := d.Forward
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+	conn, err := forward.DialContext(ctx, "tcp", d.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound the handshake by ctx: its deadline applies directly, and
+	// cancellation expires all pending I/O.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+
+	if d.URL.Scheme == "http" {
+		conn, err = d.connect(conn, addr)
+	} else {
+		err = d.socks5(ctx, conn, addr)
+	}
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// SOCKS5 constants from RFC 1928 and RFC 1929.
+const (
+	socksVersion      = 5
+	socksNoAuth       = 0
+	socksUserPass     = 2
+	socksNoAcceptable = 0xff
+	socksConnect      = 1
+	socksIPv4         = 1
+	socksDomain       = 3
+	socksIPv6         = 4
+)
+
+var socksReplies = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// credentials returns the SOCKS username and password to send, if any.
+func (d *ProxyDialer) credentials() (string, string, error) {
+	if d.URL.User != nil {
+		password, _ := d.URL.User.Password()
+		return d.URL.User.Username(), password, nil
+	}
+	if !d.Isolate {
+		return "", "", nil
+	}
+	token, err := utils.RandomString(16)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate proxy credentials: %v", err)
+	}
+	return token, token, nil
+}
+
+// socks5 performs the SOCKS5 handshake for a CONNECT to addr on conn.
+func (d *ProxyDialer) socks5(ctx context.Context, conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	req := []byte{socksVersion, socksConnect, 0}
+	ip := net.ParseIP(host)
+	if ip == nil && d.URL.Scheme == "socks5" {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return err
+		}
+		ip = ips[0]
+	}
+	switch {
+	case ip == nil:
+		if len(host) > 255 {
+			return fmt.Errorf("host name too long: %s", host)
+		}
+		req = append(req, socksDomain, byte(len(host)))
+		req = append(req, host...)
+	case ip.To4() != nil:
+		req = append(req, socksIPv4)
+		req = append(req, ip.To4()...)
+	default:
+		req = append(req, socksIPv6)
+		req = append(req, ip.To16()...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+
+	user, password, err := d.credentials()
+	if err != nil {
+		return err
+	}
+	if len(user) > 255 || len(password) > 255 {
+		return fmt.Errorf("proxy credentials too long")
+	}
+	// Offer only username/password when credentials are set, so the proxy
+	// cannot skip them and defeat stream isolation.
+	method := byte(socksNoAuth)
+	if user != "" || password != "" {
+		method = socksUserPass
+	}
+
+	if _, err := conn.Write([]byte{socksVersion, 1, method}); err != nil {
+		return err
+	}
+	var resp [2]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return err
+	}
+	if resp[0] != socksVersion {
+		return fmt.Errorf("%w: unexpected SOCKS version %d", ErrProxy, resp[0])
+	}
+	if resp[1] == socksNoAcceptable || resp[1] != method {
+		return fmt.Errorf("%w: no acceptable authentication method", ErrProxy)
+	}
+
+	if method == socksUserPass {
+		auth := []byte{1, byte(len(user))}
+		auth = append(auth, user...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, resp[:]); err != nil {
+			return err
+		}
+		if resp[1] != 0 {
+			return fmt.Errorf("%w: authentication failed", ErrProxy)
+		}
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	var reply [4]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("%w: unexpected SOCKS version %d", ErrProxy, reply[0])
+	}
+	if reply[1] != 0 {
+		reason, ok := socksReplies[reply[1]]
+		if !ok {
+			reason = fmt.Sprintf("reply code %d", reply[1])
+		}
+		return fmt.Errorf("%w: %s", ErrProxy, reason)
+	}
+
+	// Skip the bound address, which the client does not need.
+	var skip int
+	switch reply[3] {
+	case socksIPv4:
+		skip = net.IPv4len
+	case socksIPv6:
+		skip = net.IPv6len
+	case socksDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("%w: unknown address type %d", ErrProxy, reply[3])
+	}
+	_, err = io.CopyN(io.Discard, conn, int64(skip)+2)
+	return err
+}
+
+// connect opens an HTTP CONNECT tunnel to addr on conn.
+func (d *ProxyDialer) connect(conn net.Conn, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.URL.User != nil {
+		password, _ := d.URL.User.Password()
+		credentials := d.URL.User.Username() + ":" + password
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	if err := req.Write(conn); err != nil {
+		return conn, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return conn, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return conn, fmt.Errorf("%w: %s", ErrProxy, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn returns data read ahead while parsing the proxy response
+// before reading from the connection again.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,345 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// socksRequest records what a client sent to the test SOCKS5 server.
+type socksRequest struct {
+	user, password string
+	addrType       byte
+	host           string
+	port           uint16
+}
+
+// socksServer is a minimal in-process SOCKS5 server. Every CONNECT is
+// forwarded to target, whatever address the client asked for, so tests can
+// use names that only the proxy "resolves".
+type socksServer struct {
+	addr   string
+	target string
+	// user and password, if set, are required from clients.
+	user, password string
+
+	mu       sync.Mutex
+	requests []socksRequest
+}
+
+func newSOCKSServer(t *testing.T, target, user, password string) *socksServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &socksServer{addr: ln.Addr().String(), target: target, user: user, password: password}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socksServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	var req socksRequest
+
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return
+	}
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksUserPass || (m == socksNoAuth && s.user == "") {
+			method = m
+			break
+		}
+	}
+	conn.Write([]byte{socksVersion, method})
+	if method == socksNoAcceptable {
+		return
+	}
+
+	if method == socksUserPass {
+		readString := func() string {
+			n, _ := r.ReadByte()
+			b := make([]byte, n)
+			io.ReadFull(r, b)
+			return string(b)
+		}
+		r.ReadByte() // subnegotiation version
+		req.user = readString()
+		req.password = readString()
+		if s.user != "" && (req.user != s.user || req.password != s.password) {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	head = make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return
+	}
+	req.addrType = head[3]
+	switch req.addrType {
+	case socksIPv4, socksIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if req.addrType == socksIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		io.ReadFull(r, ip)
+		req.host = ip.String()
+	case socksDomain:
+		n, _ := r.ReadByte()
+		b := make([]byte, n)
+		io.ReadFull(r, b)
+		req.host = string(b)
+	}
+	port := make([]byte, 2)
+	io.ReadFull(r, port)
+	req.port = binary.BigEndian.Uint16(port)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", s.target)
+	if err != nil {
+		conn.Write([]byte{socksVersion, 5, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{socksVersion, 0, 0, socksIPv4, 127, 0, 0, 1, 0, 0})
+	pipe(conn, r, upstream)
+}
+
+func (s *socksServer) seen() []socksRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]socksRequest(nil), s.requests...)
+}
+
+// pipe copies between the client (read through r) and upstream until
+// either side closes.
+func pipe(client net.Conn, r io.Reader, upstream net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, r)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// newConnectProxy starts an HTTP CONNECT proxy that forwards every tunnel to
+// target and requires auth as the Proxy-Authorization header if set.
+func newConnectProxy(t *testing.T, target, auth string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				req, err := http.ReadRequest(r)
+				if err != nil {
+					return
+				}
+				if req.Method != http.MethodConnect {
+					io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+					return
+				}
+				if auth != "" && req.Header.Get("Proxy-Authorization") != auth {
+					io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer upstream.Close()
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				pipe(conn, r, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestProxyDial(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport string
+		scheme    string
+		userinfo  string // credentials put in the proxy URL
+		need      string // credentials required by the proxy, "user:password"
+		remoteDNS bool   // whether the SOCKS proxy should receive the name
+		wantErr   error
+	}{
+		{name: "socks5h sends name", transport: "tls", scheme: "socks5h", remoteDNS: true},
+		{name: "socks5 resolves locally", transport: "tls", scheme: "socks5"},
+		{name: "socks5h over websocket", transport: "websocket", scheme: "socks5h", remoteDNS: true},
+		{name: "socks5 credentials", transport: "tls", scheme: "socks5h", userinfo: "bob:pw", need: "bob:pw", remoteDNS: true},
+		{name: "socks5 wrong credentials", transport: "tls", scheme: "socks5h", userinfo: "bob:nope", need: "bob:pw", wantErr: ErrProxy},
+		{name: "http connect", transport: "tls", scheme: "http"},
+		{name: "http connect over websocket", transport: "websocket", scheme: "http"},
+		{name: "http connect credentials", transport: "tls", scheme: "http", userinfo: "bob:pw", need: "bob:pw"},
+		{name: "http connect wrong credentials", transport: "tls", scheme: "http", userinfo: "bob:nope", need: "bob:pw", wantErr: ErrProxy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, true)
+			if tt.transport == "websocket" {
+				srv = newWebSocketTestServer(t, true)
+			}
+
+			var socks *socksServer
+			var proxyAddr string
+			if tt.scheme == "http" {
+				var auth string
+				if tt.need != "" {
+					auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(tt.need))
+				}
+				proxyAddr = newConnectProxy(t, srv.addr, auth)
+			} else {
+				user, password, _ := strings.Cut(tt.need, ":")
+				socks = newSOCKSServer(t, srv.addr, user, password)
+				proxyAddr = socks.addr
+			}
+
+			opts := srv.options(t)
+			opts.Host = "localhost"
+			opts.Config.Transport = tt.transport
+			opts.Config.Proxy = tt.scheme + "://" + proxyAddr
+			if tt.userinfo != "" {
+				opts.Config.Proxy = tt.scheme + "://" + tt.userinfo + "@" + proxyAddr
+			}
+
+			session, err := Dial(context.Background(), opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Dial() error = %v, want %v", err, tt.wantErr)
+				}
+				if !Retryable(err) {
+					t.Errorf("proxy error %v is not retryable", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer session.Close()
+			srv.accept(t)
+			if session.Fingerprint() != srv.fingerprint {
+				t.Errorf("Fingerprint() = %q, want %q", session.Fingerprint(), srv.fingerprint)
+			}
+
+			if socks == nil {
+				return
+			}
+			reqs := socks.seen()
+			if len(reqs) != 1 {
+				t.Fatalf("proxy saw %d requests, want 1", len(reqs))
+			}
+			req := reqs[0]
+			if got := req.addrType == socksDomain; got != tt.remoteDNS {
+				t.Errorf("proxy received host %q (address type %d), remote DNS = %v, want %v", req.host, req.addrType, got, tt.remoteDNS)
+			}
+			if tt.remoteDNS && req.host != "localhost" {
+				t.Errorf("host = %q, want %q", req.host, "localhost")
+			}
+			if got := req.user + ":" + req.password; tt.need != "" && got != tt.need {
+				t.Errorf("credentials = %q, want %q", got, tt.need)
+			}
+		})
+	}
+}
+
+func TestProxyIsolation(t *testing.T) {
+	srv := newTestServer(t, true)
+	socks := newSOCKSServer(t, srv.addr, "", "")
+	opts := srv.options(t)
+	opts.Config.Proxy = "socks5h://" + socks.addr
+	opts.Config.ProxyIsolation = true
+
+	for range 2 {
+		session, err := Dial(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		srv.accept(t)
+		session.Close()
+	}
+
+	reqs := socks.seen()
+	if len(reqs) != 2 {
+		t.Fatalf("proxy saw %d requests, want 2", len(reqs))
+	}
+	if reqs[0].user == "" || reqs[0].password == "" {
+		t.Errorf("no credentials sent: %+v", reqs[0])
+	}
+	if reqs[0].user == reqs[1].user {
+		t.Errorf("sessions share SOCKS username %q", reqs[0].user)
+	}
+}
+
+func TestNewProxyDialer(t *testing.T) {
+	tests := []struct {
+		url      string
+		isolate  bool
+		wantHost string
+		wantErr  bool
+	}{
+		{url: "socks5h://127.0.0.1:9050", wantHost: "127.0.0.1:9050"},
+		{url: "socks5://proxy.example", wantHost: "proxy.example:1080"},
+		{url: "http://user:pw@[::1]", wantHost: "[::1]:80"},
+		{url: "socks5h://127.0.0.1:9050", isolate: true, wantHost: "127.0.0.1:9050"},
+		{url: "http://proxy.example:3128", isolate: true, wantErr: true},
+		{url: "https://proxy.example", wantErr: true},
+		{url: "socks5://", wantErr: true},
+		{url: "://bad", wantErr: true},
+	}
+	for _, tt := range tests {
+		d, err := NewProxyDialer(tt.url, tt.isolate)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewProxyDialer(%q, %v) error = %v, wantErr %v", tt.url, tt.isolate, err, tt.wantErr)
+			continue
+		}
+		if err == nil && d.URL.Host != tt.wantHost {
+			t.Errorf("NewProxyDialer(%q) host = %q, want %q", tt.url, d.URL.Host, tt.wantHost)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"math/rand"
+	"time"
+
+	"silent_chat/pkg/config"
+)
+
+// RetryPolicy decides whether and when to reconnect after a failure.
+// Policies are stateless: the caller counts consecutive failed attempts and
+// starts again from one after a successful connection.
+type RetryPolicy interface {
+	// Next returns the delay before the next attempt, given the number of
+	// consecutive failed attempts so far (starting at 1) and the last
+	// error. It returns false if the caller should give up.
+	Next(attempt int, err error) (time.Duration, bool)
+}
+
+// ExponentialBackoff waits a random delay between zero and Base*2^(attempt-1),
+// capped at Max ("full jitter"). It gives up only on errors that are not
+// Retryable.
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	// rand returns a non-negative random number below n. Tests replace it.
+	rand func(n int64) int64
+}
+
+func (b ExponentialBackoff) Next(attempt int, err error) (time.Duration, bool) {
+	if !Retryable(err) {
+		return 0, false
+	}
+	if b.Base <= 0 {
+		return 0, true
+	}
+
+	ceiling := b.Max
+	if attempt < 1 {
+		attempt = 1
+	}
+	// Stop doubling before the shift overflows; the cap applies anyway.
+	if shift := attempt - 1; shift < 32 {
+		d := b.Base << shift
+		if d > 0 && (ceiling <= 0 || d < ceiling) {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		ceiling = b.Base
+	}
+
+	random := b.rand
+	if random == nil {
+		random = rand.Int63n
+	}
+	return time.Duration(random(int64(ceiling))), true
+}
+
+// CappedRetry gives up after MaxAttempts consecutive failures and otherwise
+// defers to Policy.
+type CappedRetry struct {
+	Policy      RetryPolicy
+	MaxAttempts int
+}
+
+func (c CappedRetry) Next(attempt int, err error) (time.Duration, bool) {
+	if attempt >= c.MaxAttempts {
+		return 0, false
+	}
+	return c.Policy.Next(attempt, err)
+}
+
+// CircuitBreaker stops hammering an unreachable server: after every
+// Threshold consecutive failures the circuit opens and the next attempt
+// waits Cooldown instead of the delay chosen by Policy.
+type CircuitBreaker struct {
+	Policy    RetryPolicy
+	Threshold int
+	Cooldown  time.Duration
+}
+
+func (c CircuitBreaker) Next(attempt int, err error) (time.Duration, bool) {
+	delay, ok := c.Policy.Next(attempt, err)
+	if !ok {
+		return 0, false
+	}
+	if c.Threshold > 0 && attempt%c.Threshold == 0 && c.Cooldown > delay {
+		return c.Cooldown, true
+	}
+	return delay, true
+}
+
+// NewRetryPolicy builds the retry policy described by cfg: exponential
+// backoff from ReconnectDelay up to MaxReconnectDelay, a circuit breaker if
+// CircuitBreakerThreshold is set, and a limit if MaxRetries is set.
+func NewRetryPolicy(cfg *config.Config) RetryPolicy {
+	var policy RetryPolicy = ExponentialBackoff{
+		Base: cfg.ReconnectDelay,
+		Max:  cfg.MaxReconnectDelay,
+	}
+	if cfg.CircuitBreakerThreshold > 0 {
+		policy = CircuitBreaker{
+			Policy:    policy,
+			Threshold: cfg.CircuitBreakerThreshold,
+			Cooldown:  cfg.CircuitBreakerCooldown,
+		}
+	}
+	if cfg.MaxRetries > 0 {
+		policy = CappedRetry{Policy: policy, MaxAttempts: cfg.MaxRetries}
+	}
+	return policy
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"silent_chat/pkg/config"
+)
+
+// maxRand makes full jitter deterministic by always picking the largest delay.
+func maxRand(n int64) int64 { return n - 1 }
+
+var errConnTest = &NetworkError{Op: "read", Err: errors.New("reset")}
+
+func TestExponentialBackoff(t *testing.T) {
+	netErr := errConnTest
+	b := ExponentialBackoff{Base: time.Second, Max: 10 * time.Second, rand: maxRand}
+
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		want    time.Duration
+		wantOK  bool
+	}{
+		{name: "first attempt", attempt: 1, err: netErr, want: time.Second - 1, wantOK: true},
+		{name: "doubles", attempt: 3, err: netErr, want: 4*time.Second - 1, wantOK: true},
+		{name: "capped", attempt: 5, err: netErr, want: 10*time.Second - 1, wantOK: true},
+		{name: "no overflow", attempt: 200, err: netErr, want: 10*time.Second - 1, wantOK: true},
+		{name: "fingerprint mismatch", attempt: 1, err: ErrFingerprintMismatch, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := b.Next(tt.attempt, tt.err)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("Next(%d) = %v, %v, want %v, %v", tt.attempt, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFullJitterStaysInRange(t *testing.T) {
+	b := ExponentialBackoff{Base: 100 * time.Millisecond, Max: time.Second}
+	for attempt := 1; attempt <= 10; attempt++ {
+		for i := 0; i < 50; i++ {
+			d, ok := b.Next(attempt, errConnTest)
+			if !ok || d < 0 || d >= time.Second {
+				t.Fatalf("Next(%d) = %v, %v, want [0, 1s)", attempt, d, ok)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyFromConfig(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.ReconnectDelay = time.Second
+	cfg.MaxReconnectDelay = 2 * time.Second
+	cfg.CircuitBreakerThreshold = 3
+	cfg.CircuitBreakerCooldown = time.Minute
+	cfg.MaxRetries = 5
+	policy := NewRetryPolicy(cfg)
+
+	tests := []struct {
+		attempt      int
+		wantOK       bool
+		wantCooldown bool
+	}{
+		{attempt: 1, wantOK: true},
+		{attempt: 2, wantOK: true},
+		{attempt: 3, wantOK: true, wantCooldown: true},
+		{attempt: 4, wantOK: true},
+		{attempt: 5, wantOK: false},
+	}
+	for _, tt := range tests {
+		d, ok := policy.Next(tt.attempt, errConnTest)
+		if ok != tt.wantOK {
+			t.Errorf("Next(%d) ok = %v, want %v", tt.attempt, ok, tt.wantOK)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if tt.wantCooldown && d != time.Minute {
+			t.Errorf("Next(%d) = %v, want circuit breaker cooldown", tt.attempt, d)
+		}
+		if !tt.wantCooldown && d >= cfg.MaxReconnectDelay {
+			t.Errorf("Next(%d) = %v, want below %v", tt.attempt, d, cfg.MaxReconnectDelay)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"silent_chat/internal/utils"
+	"silent_chat/pkg/config"
+	"silent_chat/pkg/protocol"
+	"silent_chat/pkg/transcript"
+)
+
+// Session is an authenticated connection to the server. It is safe for
+// concurrent use. Incoming traffic is delivered on Events until the session
+// closes, after which the channel is closed.
+type Session struct {
+	conn        net.Conn
+	addr        string
+	username    string
+	config      *config.Config
+	resumeToken string
+	fingerprint string
+	endpoint    Endpoint
+	fallback    bool
+	logger      *slog.Logger
+	metrics     *Metrics
+
+	writeMu      sync.Mutex
+	sessionNonce string
+	sendSeq      uint64
+	reader       *frameReader
+	replay       *protocol.ReplayGuard
+	transcript   *transcript.Chain
+	machine      *Machine
+	ownsMachine  bool
+
+	// control and bulk are the writer goroutine's priority lanes; queueMu
+	// serialises the capacity check of the bulk lane with the send to it.
+	control chan outgoing
+	bulk    chan outgoing
+	queueMu sync.Mutex
+
+	events    chan Event
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	cause     error
+}
+
+func newSession(
+	conn net.Conn,
+	addr, username string,
+	cfg *config.Config,
+	machine *Machine,
+) *Session {
+	queueSize := cfg.SendQueueSize
+	if queueSize <= 0 {
+		queueSize = defaultSendQueueSize
+	}
+	return &Session{
+		conn:       conn,
+		addr:       addr,
+		username:   username,
+		config:     cfg,
+		reader:     newFrameReader(conn, cfg),
+		transcript: transcript.NewChain(username),
+		machine:    machine,
+		logger:     slog.Default(),
+		control:    make(chan outgoing, 16),
+		bulk:       make(chan outgoing, queueSize),
+		events:     make(chan Event, 64),
+		done:       make(chan struct{}),
+	}
+}
+
+// start launches the read loop, the writer and the fake traffic generator.
+func (s *Session) start() {
+	s.emit(StateEvent{State: StateReady})
+	go s.readLoop()
+	go s.writeLoop()
+	go s.fakeLoop()
+}
+
+// Addr returns the server address of the session.
+func (s *Session) Addr() string {
+	return s.addr
+}
+
+// Endpoint returns the endpoint the session is connected to.
+func (s *Session) Endpoint() Endpoint {
+	return s.endpoint
+}
+
+// Fallback reports whether the session is connected to an endpoint other
+// than the first one in Options.Endpoints.
+func (s *Session) Fallback() bool {
+	return s.fallback
+}
+
+// Username returns the name the session authenticated with.
+func (s *Session) Username() string {
+	return s.username
+}
+
+// ResumeToken returns the token issued by the server for resuming this
+// session without the password, or "" if the server did not issue one.
+func (s *Session) ResumeToken() string {
+	return s.resumeToken
+}
+
+// Fingerprint returns the SHA256 fingerprint of the server certificate in
+// lowercase hex. Show it to the user when Config.ExpectedFP is not set.
+func (s *Session) Fingerprint() string {
+	return s.fingerprint
+}
+
+// Events returns the channel of incoming messages, state changes and errors.
+func (s *Session) Events() <-chan Event {
+	return s.events
+}
+
+// Machine returns the state machine the session reports its transitions to.
+func (s *Session) Machine() *Machine {
+	return s.machine
+}
+
+// Done is closed when the session is closed.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send queues a message for the writer goroutine and waits until it is
+// written or ctx ends. Chat messages get a random ID and SenderName if they
+// have none, and are linked into the transcript chain. If ctx ends first the
+// message may still be written later. A write failure closes the session.
+func (s *Session) Send(ctx context.Context, msg protocol.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	result, err := s.SendAsync(msg)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendAsync queues a message like Send but returns without waiting. The
+// write result is delivered on the returned channel. Chat frames fail
+// with ErrQueueFull when the queue is at capacity; control frames such as
+// acks and pings skip ahead of queued chat and never wait for the jitter.
+func (s *Session) SendAsync(msg protocol.Message) (<-chan error, error) {
+	if msg.Type == "chat" {
+		if msg.ID == "" {
+			id, err := utils.RandomString(16)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate message id: %v", err)
+			}
+			msg.ID = id
+		}
+		if msg.SenderName == "" {
+			msg.SenderName = s.username
+		}
+	}
+	return s.enqueue(msg)
+}
+
+// Shutdown closes the session gracefully. If Config.SendLeave is set, a
+// "leave" message is sent first, bounded by ctx.
+func (s *Session) Shutdown(ctx context.Context) error {
+	if s.config.SendLeave {
+		select {
+		case <-s.done:
+		default:
+			if err := s.Send(ctx, protocol.Message{Type: "leave", SenderName: s.username}); err != nil {
+				s.logger.Warn("send leave message", "err", err)
+			}
+		}
+	}
+	return s.Close()
+}
+
+// Close closes the connection and stops the session's goroutines.
+func (s *Session) Close() error {
+	s.shutdown(nil)
+	return s.closeErr
+}
+
+// shutdown closes the session once, remembering the error that caused it.
+func (s *Session) shutdown(cause error) {
+	s.closeOnce.Do(func() {
+		s.cause = cause
+		close(s.done)
+		s.closeErr = s.conn.Close()
+	})
+}
+
+// emit delivers an event unless the session has been closed.
+func (s *Session) emit(ev Event) {
+	select {
+	case s.events <- ev:
+	case <-s.done:
+	}
+}
+
+// setNonce turns on replay protection with the session nonce issued by the
+// server in auth_result. Frames read before it are not checked. It must be
+// called before the session starts.
+func (s *Session) setNonce(nonce string) {
+	s.writeMu.Lock()
+	s.sessionNonce = nonce
+	s.writeMu.Unlock()
+	s.replay = protocol.NewReplayGuard(nonce, protocol.DefaultReplayWindow)
+}
+
+// readMessage reads, decodes and replay-checks the next frame. A timeout
+// mid-frame keeps the partial frame for the next call.
+func (s *Session) readMessage() (protocol.Message, error) {
+	body, err := s.reader.next()
+	if err != nil {
+		return protocol.Message{}, err
+	}
+
+	var msg protocol.Message
+	err = json.Unmarshal(body, &msg)
+	s.metrics.frameReceived(msg.Type, len(body)+4)
+	if err != nil {
+		return protocol.Message{}, fmt.Errorf("%w: failed to decode JSON: %v", ErrProtocol, err)
+	}
+
+	if s.replay != nil {
+		if err := s.replay.Check(msg); err != nil {
+			return protocol.Message{}, err
+		}
+	}
+
+	return msg, nil
+}
+
+func (s *Session) writeMessage(msg protocol.Message) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.sendSeq++
+	msg.Nonce = s.sessionNonce
+	msg.Seq = s.sendSeq
+
+	data, err := protocol.EncodeMessage(msg, s.config)
+	if err != nil {
+		return err
+	}
+	n, err := s.conn.Write(data)
+	s.metrics.frameSent(msg.Type, n)
+	if err != nil {
+		return &NetworkError{Op: "write", Err: err}
+	}
+	if n != len(data) {
+		return &NetworkError{
+			Op:  "write",
+			Err: fmt.Errorf("incomplete write: wrote %d bytes out of %d", n, len(data)),
+		}
+	}
+	return nil
+}
+
+func (s *Session) readLoop() {
+	var closeErr error
+	defer func() {
+		if r := recover(); r != nil {
+			closeErr = fmt.Errorf("read loop panic: %v", r)
+		}
+		s.shutdown(closeErr)
+		if closeErr == nil {
+			closeErr = s.cause
+		}
+		s.logger.Info("session closed", "addr", s.addr, "err", closeErr)
+		s.machine.Transition(StateDisconnected, closeErr)
+		if s.ownsMachine {
+			s.machine.Close()
+		}
+		select {
+		case s.events <- StateEvent{State: StateDisconnected, Err: closeErr}:
+		default:
+		}
+		close(s.events)
+	}()
+
+	for {
+		if s.config.ReadTimeout > 0 {
+			s.conn.SetReadDeadline(time.Now().Add(s.config.ReadTimeout))
+		}
+
+		msg, err := s.readMessage()
+		if err != nil {
+			// The peer is slow or idle. The frame reader keeps any partial
+			// frame, so just check whether we were closed and read on.
+			if isTimeout(err) {
+				select {
+				case <-s.done:
+					return
+				default:
+				}
+				continue
+			}
+
+			var replayErr *protocol.ReplayError
+			if errors.As(err, &replayErr) {
+				s.logger.Warn("frame rejected", "err", err)
+				s.emit(ErrorEvent{Err: err})
+				continue
+			}
+
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			closeErr = err
+			return
+		}
+
+		s.logger.Debug("frame received", "type", msg.Type, "seq", msg.Seq)
+		var warnings []string
+		if msg.Type == "chat" && msg.Text != "" && msg.SenderName != "" {
+			warnings = s.transcript.Verify(msg)
+		}
+		s.emit(MessageEvent{Message: msg, Warnings: warnings})
+	}
+}
+
+// fakeLoop periodically sends random "fake" frames to obscure traffic patterns.
+func (s *Session) fakeLoop() {
+	delay := time.Duration(rand.Intn(30)+1) * time.Second
+	ticker := time.NewTicker(delay)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.sendFakeMessage(); err != nil {
+				s.logger.Warn("send fake message", "err", err)
+			}
+		}
+	}
+}
+
+func (s *Session) sendFakeMessage() error {
+	randInt := rand.Intn(39) + 1
+	randString, err := utils.RandomString(randInt)
+	if err != nil {
+		return fmt.Errorf("failed to generate random string: %v", err)
+	}
+	fake := protocol.Message{
+		Type: "fake",
+		Text: randString,
+	}
+
+	_, err = s.SendAsync(fake)
+	if errors.Is(err, ErrQueueFull) {
+		// The connection is busy anyway; skip this round.
+		return nil
+	}
+	return err
+}
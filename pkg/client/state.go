@@ -0,0 +1,270 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// State is the connection state of a client.
+type State int
+
+const (
+	StateDisconnected State = iota
+	StateDialing
+	StateVerifying
+	StateAuthenticating
+	StateReady
+	StateBackoff
+	StateClosed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateDialing:
+		return "dialing"
+	case StateVerifying:
+		return "verifying"
+	case StateAuthenticating:
+		return "authenticating"
+	case StateReady:
+		return "ready"
+	case StateBackoff:
+		return "backoff"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// transitions lists the states reachable from each state. Any state except
+// Closed may move to Closed, which is terminal.
+var transitions = map[State][]State{
+	StateDisconnected:   {StateDialing, StateBackoff},
+	StateDialing:        {StateVerifying, StateDisconnected, StateBackoff},
+	StateVerifying:      {StateAuthenticating, StateDisconnected, StateBackoff},
+	StateAuthenticating: {StateReady, StateDisconnected, StateBackoff},
+	StateReady:          {StateDisconnected, StateBackoff},
+	StateBackoff:        {StateDialing, StateDisconnected},
+}
+
+// ErrMachineClosed is returned by Machine methods after the machine reached StateClosed.
+var ErrMachineClosed = errors.New("state machine closed")
+
+// InvalidTransitionError is returned when a transition is not allowed from the current state.
+type InvalidTransitionError struct {
+	From, To State
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("invalid state transition %v -> %v", e.From, e.To)
+}
+
+// StateChange describes a single transition. Err is the reason for entering
+// a failure state such as Disconnected or Backoff, if known.
+type StateChange struct {
+	From State
+	To   State
+	Err  error
+}
+
+// Machine is the connection state machine. All reads and transitions are
+// executed by a single owner goroutine, so the state is never observed
+// half-updated. Subscribers receive every change in order.
+type Machine struct {
+	ops  chan func()
+	done chan struct{}
+
+	// owned by the run goroutine
+	state       State
+	subscribers map[*subscriber]struct{}
+}
+
+// NewMachine creates a Machine in StateDisconnected and starts its owner goroutine.
+func NewMachine() *Machine {
+	m := &Machine{
+		ops:         make(chan func()),
+		done:        make(chan struct{}),
+		state:       StateDisconnected,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+	go m.run()
+	return m
+}
+
+func (m *Machine) run() {
+	for {
+		select {
+		case op := <-m.ops:
+			op()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// do executes op on the owner goroutine and waits for it to finish.
+func (m *Machine) do(op func()) error {
+	finished := make(chan struct{})
+	select {
+	case m.ops <- func() { op(); close(finished) }:
+		<-finished
+		return nil
+	case <-m.done:
+		return ErrMachineClosed
+	}
+}
+
+// State returns the current state.
+func (m *Machine) State() State {
+	state := StateClosed
+	m.do(func() { state = m.state })
+	return state
+}
+
+// Transition moves the machine to the given state and notifies subscribers.
+// It returns an *InvalidTransitionError if the move is not allowed.
+func (m *Machine) Transition(to State, cause error) error {
+	var result error
+	err := m.do(func() {
+		from := m.state
+		if !allowed(from, to) {
+			result = &InvalidTransitionError{From: from, To: to}
+			return
+		}
+		m.state = to
+		change := StateChange{From: from, To: to, Err: cause}
+		for sub := range m.subscribers {
+			sub.push(change)
+		}
+		if to == StateClosed {
+			for sub := range m.subscribers {
+				sub.close(false)
+			}
+			m.subscribers = nil
+			close(m.done)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// Close moves the machine to StateClosed, closes all subscriptions and stops
+// the owner goroutine. Closing a closed machine is a no-op.
+func (m *Machine) Close() {
+	m.Transition(StateClosed, nil)
+}
+
+// Subscribe returns a channel that receives every subsequent state change in
+// order, and a function that cancels the subscription. The channel is closed
+// when the subscription is cancelled or the machine is closed.
+func (m *Machine) Subscribe() (<-chan StateChange, func()) {
+	sub := newSubscriber()
+	if err := m.do(func() { m.subscribers[sub] = struct{}{} }); err != nil {
+		sub.close(true)
+		return sub.out, func() {}
+	}
+	return sub.out, func() {
+		m.do(func() { delete(m.subscribers, sub) })
+		sub.close(true)
+	}
+}
+
+func allowed(from, to State) bool {
+	if from == StateClosed {
+		return false
+	}
+	if to == StateClosed {
+		return true
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriber queues changes without bound so the owner goroutine never
+// blocks on a slow reader; a pump goroutine delivers them in order.
+type subscriber struct {
+	out chan StateChange
+
+	mu       sync.Mutex
+	queue    []StateChange
+	wake     chan struct{}
+	quit     chan struct{}
+	quitOnce sync.Once
+	closed   bool
+}
+
+func newSubscriber() *subscriber {
+	s := &subscriber{
+		out:  make(chan StateChange),
+		wake: make(chan struct{}, 1),
+		quit: make(chan struct{}),
+	}
+	go s.pump()
+	return s
+}
+
+func (s *subscriber) push(change StateChange) {
+	s.mu.Lock()
+	if !s.closed {
+		s.queue = append(s.queue, change)
+	}
+	s.mu.Unlock()
+	s.signal()
+}
+
+// close stops the subscription. Pending changes are still delivered unless
+// drop is set, which is used when the reader has gone away.
+func (s *subscriber) close(drop bool) {
+	s.mu.Lock()
+	s.closed = true
+	if drop {
+		s.queue = nil
+	}
+	s.mu.Unlock()
+	if drop {
+		s.quitOnce.Do(func() { close(s.quit) })
+	}
+	s.signal()
+}
+
+func (s *subscriber) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) pump() {
+	defer close(s.out)
+	for range s.wake {
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				closed := s.closed
+				s.mu.Unlock()
+				if closed {
+					return
+				}
+				break
+			}
+			change := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			select {
+			case s.out <- change:
+			case <-s.quit:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMachineTransitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    []State
+		wantErr bool
+	}{
+		{
+			name: "successful connect",
+			path: []State{StateDialing, StateVerifying, StateAuthenticating, StateReady},
+		},
+		{
+			name: "reconnect after drop",
+			path: []State{
+				StateDialing, StateVerifying, StateAuthenticating, StateReady,
+				StateDisconnected, StateBackoff, StateDialing,
+			},
+		},
+		{
+			name: "dial failure backs off",
+			path: []State{StateDialing, StateBackoff, StateDialing, StateVerifying},
+		},
+		{
+			name:    "ready without authentication",
+			path:    []State{StateDialing, StateReady},
+			wantErr: true,
+		},
+		{
+			name:    "nothing after closed",
+			path:    []State{StateClosed, StateDialing},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMachine()
+			defer m.Close()
+
+			var err error
+			for _, s := range tt.path {
+				if err = m.Transition(s, nil); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Transition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && m.State() != tt.path[len(tt.path)-1] {
+				t.Errorf("State() = %v, want %v", m.State(), tt.path[len(tt.path)-1])
+			}
+		})
+	}
+}
+
+func TestMachineInvalidTransitionError(t *testing.T) {
+	m := NewMachine()
+	defer m.Close()
+
+	err := m.Transition(StateReady, nil)
+	var invalid *InvalidTransitionError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Transition() error = %v, want *InvalidTransitionError", err)
+	}
+	if invalid.From != StateDisconnected || invalid.To != StateReady {
+		t.Errorf("InvalidTransitionError = %+v", invalid)
+	}
+	if m.State() != StateDisconnected {
+		t.Errorf("state changed after rejected transition: %v", m.State())
+	}
+}
+
+func TestMachineSubscribers(t *testing.T) {
+	m := NewMachine()
+	changes, cancel := m.Subscribe()
+	defer cancel()
+
+	cause := errors.New("connection reset")
+	path := []State{StateDialing, StateVerifying, StateAuthenticating, StateReady, StateDisconnected}
+	for i, s := range path {
+		var err error
+		if i == len(path)-1 {
+			err = cause
+		}
+		if err := m.Transition(s, err); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Close()
+
+	prev := StateDisconnected
+	var got []StateChange
+	for change := range changes {
+		got = append(got, change)
+	}
+	want := append(path, StateClosed)
+	if len(got) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(got), len(want), got)
+	}
+	for i, change := range got {
+		if change.From != prev || change.To != want[i] {
+			t.Errorf("change %d = %v -> %v, want %v -> %v", i, change.From, change.To, prev, want[i])
+		}
+		prev = change.To
+	}
+	if got[len(path)-1].Err != cause {
+		t.Errorf("disconnect cause = %v, want %v", got[len(path)-1].Err, cause)
+	}
+	if m.State() != StateClosed {
+		t.Errorf("State() after Close = %v", m.State())
+	}
+	if err := m.Transition(StateDialing, nil); !errors.Is(err, ErrMachineClosed) {
+		t.Errorf("Transition() after Close = %v, want ErrMachineClosed", err)
+	}
+}
+
+func TestMachineConcurrentUse(t *testing.T) {
+	m := NewMachine()
+	defer m.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		changes, cancel := m.Subscribe()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			timeout := time.After(200 * time.Millisecond)
+			for {
+				select {
+				case _, ok := <-changes:
+					if !ok {
+						return
+					}
+				case <-timeout:
+					return
+				}
+			}
+		}()
+	}
+
+	cycle := []State{StateDialing, StateVerifying, StateAuthenticating, StateReady, StateDisconnected}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, s := range cycle {
+					m.Transition(s, nil)
+					_ = m.State()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	switch m.State() {
+	case StateDisconnected, StateDialing, StateVerifying, StateAuthenticating, StateReady:
+	default:
+		t.Errorf("unexpected final state %v", m.State())
+	}
+}
+
+func TestSessionReportsTransitions(t *testing.T) {
+	srv := newTestServer(t, true)
+	machine := NewMachine()
+	defer machine.Close()
+	changes, cancel := machine.Subscribe()
+	defer cancel()
+
+	opts := srv.options(t)
+	opts.Machine = machine
+	session, err := Dial(t.Context(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.accept(t)
+	session.Close()
+
+	want := []State{StateDialing, StateVerifying, StateAuthenticating, StateReady, StateDisconnected}
+	for _, s := range want {
+		select {
+		case change := <-changes:
+			if change.To != s {
+				t.Fatalf("transition to %v, want %v", change.To, s)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %v", s)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"silent_chat/pkg/config"
+
+	"github.com/coder/websocket"
+)
+
+// Transport opens the byte stream that carries frames to the server.
+//
+// Dial must perform the TLS handshake with tlsConfig as given: Dial pins
+// the server certificate through tlsConfig.VerifyConnection, so every
+// transport verifies the fingerprint the same way and before any frame is
+// sent. The returned state describes the completed handshake.
+type Transport interface {
+	Dial(ctx context.Context, addr string, tlsConfig *tls.Config) (net.Conn, tls.ConnectionState, error)
+}
+
+// TLSTransport connects with TLS over a plain TCP connection.
+type TLSTransport struct {
+	Timeout time.Duration // Dial timeout; zero means no timeout beyond ctx
+	// Dialer, if set, opens the TCP connection, for example through a proxy.
+	Dialer ContextDialer
+}
+
+func (t TLSTransport) Dial(ctx context.Context, addr string, tlsConfig *tls.Config) (net.Conn, tls.ConnectionState, error) {
+	if t.Dialer == nil {
+		dialer := &tls.Dialer{
+			NetDialer: &net.Dialer{Timeout: t.Timeout},
+			Config:    tlsConfig,
+		}
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, tls.ConnectionState{}, err
+		}
+		return conn, conn.(*tls.Conn).ConnectionState(), nil
+	}
+
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	raw, err := t.Dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, tls.ConnectionState{}, err
+	}
+	cfg := tlsConfig
+	if cfg.ServerName == "" {
+		host, _, _ := net.SplitHostPort(addr)
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+	conn := tls.Client(raw, cfg)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, tls.ConnectionState{}, err
+	}
+	return conn, conn.ConnectionState(), nil
+}
+
+// WebSocketTransport tunnels the frame stream through a WebSocket over
+// HTTPS, for networks that only allow web traffic. Each frame is sent as
+// one binary message; the server may split its frames across messages.
+type WebSocketTransport struct {
+	Path      string        // Request path of the WebSocket endpoint (default "/ws")
+	Timeout   time.Duration // Timeout for the connection and upgrade; zero means no timeout beyond ctx
+	ReadLimit int64         // Maximum size of a received message (default 32KiB)
+	// Dialer, if set, opens the TCP connection, for example through a proxy.
+	Dialer ContextDialer
+
+	// HTTPTransport, if set, is cloned to carry the upgrade request. Its TLS
+	// settings are replaced, and so is its DialContext if Dialer is set.
+	HTTPTransport *http.Transport
+}
+
+func (t WebSocketTransport) Dial(ctx context.Context, addr string, tlsConfig *tls.Config) (net.Conn, tls.ConnectionState, error) {
+	path := t.Path
+	if path == "" {
+		path = "/ws"
+	}
+	u := url.URL{Scheme: "https", Host: addr, Path: path}
+
+	// Record the handshake state while keeping the caller's verification.
+	var (
+		mu    sync.Mutex
+		state tls.ConnectionState
+	)
+	cfg := tlsConfig.Clone()
+	verify := tlsConfig.VerifyConnection
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(cs); err != nil {
+				return err
+			}
+		}
+		mu.Lock()
+		state = cs
+		mu.Unlock()
+		return nil
+	}
+
+	httpTransport := &http.Transport{}
+	if t.HTTPTransport != nil {
+		httpTransport = t.HTTPTransport.Clone()
+	}
+	httpTransport.TLSClientConfig = cfg
+	httpTransport.ForceAttemptHTTP2 = false
+	if t.Dialer != nil {
+		httpTransport.DialContext = t.Dialer.DialContext
+	}
+
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	ws, _, err := websocket.Dial(ctx, u.String(), &websocket.DialOptions{
+		HTTPClient: &http.Client{Transport: httpTransport},
+	})
+	if err != nil {
+		return nil, tls.ConnectionState{}, err
+	}
+	if t.ReadLimit > 0 {
+		ws.SetReadLimit(t.ReadLimit)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(state.PeerCertificates) == 0 {
+		ws.Close(websocket.StatusPolicyViolation, "")
+		return nil, tls.ConnectionState{}, fmt.Errorf("no server certificates found")
+	}
+	// The connection outlives the dial context, so it gets its own.
+	conn := websocket.NetConn(context.Background(), ws, websocket.MessageBinary)
+	return newWSConn(conn, ws), state, nil
+}
+
+// wsConn adapts the net.Conn of a WebSocket to behave like a TCP
+// connection.
+//
+// websocket.NetConn closes the whole connection when a read deadline
+// passes, which would turn every idle Config.ReadTimeout into a disconnect.
+// wsConn instead reads in a goroutine without a deadline, and a deadline
+// only makes Read return a timeout error; the data arriving later is kept
+// for the next Read.
+//
+// Close does not wait up to five seconds for the server to answer the close
+// handshake, so that closing a session is as quick as with TLSTransport.
+type wsConn struct {
+	net.Conn
+	ws *websocket.Conn
+
+	chunks    chan wsChunk
+	closed    chan struct{}
+	closeOnce sync.Once
+	deadline  readDeadline
+
+	readMu  sync.Mutex
+	pending []byte // rest of the last chunk not yet returned by Read
+	readErr error
+}
+
+// wsChunk is the result of one read by wsConn.readLoop.
+type wsChunk struct {
+	data []byte
+	err  error
+}
+
+func newWSConn(conn net.Conn, ws *websocket.Conn) *wsConn {
+	c := &wsConn{
+		Conn:     conn,
+		ws:       ws,
+		chunks:   make(chan wsChunk),
+		closed:   make(chan struct{}),
+		deadline: readDeadline{expired: make(chan struct{})},
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *wsConn) readLoop() {
+	for {
+		buf := make([]byte, 32*1024)
+		n, err := c.Conn.Read(buf)
+		select {
+		case c.chunks <- wsChunk{data: buf[:n], err: err}:
+		case <-c.closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if len(c.pending) == 0 && c.readErr == nil {
+		select {
+		case chunk := <-c.chunks:
+			c.pending, c.readErr = chunk.data, chunk.err
+		case <-c.deadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		case <-c.closed:
+			return 0, net.ErrClosed
+		}
+	}
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return 0, c.readErr
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	c.deadline.set(t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	c.deadline.set(t)
+	return nil
+}
+
+func (c *wsConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	err := c.ws.CloseNow()
+	c.Conn.Close()
+	return err
+}
+
+// readDeadline is a read deadline that can be waited on. expired is closed
+// once the deadline has passed and replaced when a new deadline is set.
+type readDeadline struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	expired chan struct{}
+}
+
+func (d *readDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.expired // the timer fired; wait until it has closed expired
+	}
+	d.timer = nil
+
+	select {
+	case <-d.expired:
+		d.expired = make(chan struct{})
+	default:
+	}
+	if t.IsZero() {
+		return
+	}
+	if wait := time.Until(t); wait > 0 {
+		expired := d.expired
+		d.timer = time.AfterFunc(wait, func() { close(expired) })
+		return
+	}
+	close(d.expired)
+}
+
+func (d *readDeadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expired
+}
+
+// NewTransport returns the transport selected by cfg.Transport: "tls" (the
+// default) or "websocket". If cfg.Proxy is set, it connects through that
+// proxy.
+func NewTransport(cfg *config.Config) (Transport, error) {
+	var dialer ContextDialer
+	if cfg.Proxy != "" {
+		proxy, err := NewProxyDialer(cfg.Proxy, cfg.ProxyIsolation)
+		if err != nil {
+			return nil, err
+		}
+		dialer = proxy
+	}
+
+	switch cfg.Transport {
+	case "", "tls":
+		return TLSTransport{Timeout: cfg.DialTimeout, Dialer: dialer}, nil
+	case "websocket":
+		return WebSocketTransport{
+			Path:      cfg.WebSocketPath,
+			Timeout:   cfg.DialTimeout,
+			ReadLimit: int64(cfg.AbsoluteMaxPacketSize) + 4,
+			Dialer:    dialer,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q", cfg.Transport)
+	}
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"silent_chat/pkg/config"
+	"silent_chat/pkg/protocol"
+
+	"github.com/coder/websocket"
+)
+
+// newWebSocketTestServer starts an httptest TLS server that upgrades /ws
+// and speaks the same framed protocol as newTestServer over the WebSocket.
+func newWebSocketTestServer(t *testing.T, accept bool) *testServer {
+	t.Helper()
+	s := &testServer{allow: accept, conns: make(chan *serverConn, 4)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn := websocket.NetConn(context.Background(), ws, websocket.MessageBinary)
+		s.handle(t, conn)
+	})
+	srv := httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+
+	s.addr = strings.TrimPrefix(srv.URL, "https://")
+	s.fingerprint = protocol.CertFingerprint(srv.Certificate())
+	return s
+}
+
+func TestTransports(t *testing.T) {
+	servers := []struct {
+		name      string
+		start     func(t *testing.T, accept bool) *testServer
+		transport string
+	}{
+		{name: "tls", start: newTestServer, transport: "tls"},
+		{name: "websocket", start: newWebSocketTestServer, transport: "websocket"},
+	}
+
+	for _, srvCase := range servers {
+		t.Run(srvCase.name, func(t *testing.T) {
+			t.Run("send and receive", func(t *testing.T) {
+				srv := srvCase.start(t, true)
+				opts := srv.options(t)
+				opts.Config.Transport = srvCase.transport
+				opts.Config.SendJitter = 0
+
+				session, err := Dial(context.Background(), opts)
+				if err != nil {
+					t.Fatalf("Dial() error = %v", err)
+				}
+				defer session.Close()
+				sc := srv.accept(t)
+
+				if session.Fingerprint() != srv.fingerprint {
+					t.Errorf("Fingerprint() = %q, want %q", session.Fingerprint(), srv.fingerprint)
+				}
+				if err := session.Send(context.Background(), protocol.Message{Type: "chat", Text: "hi"}); err != nil {
+					t.Fatalf("Send() error = %v", err)
+				}
+				if got := sc.readType("chat"); got.Text != "hi" {
+					t.Errorf("server received %+v", got)
+				}
+
+				sc.write(protocol.Message{Type: "chat", ID: "1", Text: "hello", SenderName: "bob"})
+				if ev := nextEvent[MessageEvent](t, session); ev.Message.Text != "hello" {
+					t.Errorf("received %+v", ev.Message)
+				}
+			})
+
+			t.Run("idle past read timeout", func(t *testing.T) {
+				srv := srvCase.start(t, true)
+				opts := srv.options(t)
+				opts.Config.Transport = srvCase.transport
+				opts.Config.ReadTimeout = 20 * time.Millisecond
+
+				session, err := Dial(context.Background(), opts)
+				if err != nil {
+					t.Fatalf("Dial() error = %v", err)
+				}
+				defer session.Close()
+				sc := srv.accept(t)
+
+				// Several read deadlines pass before the server speaks.
+				time.Sleep(10 * opts.Config.ReadTimeout)
+				sc.write(protocol.Message{Type: "chat", ID: "1", Text: "still there?", SenderName: "bob"})
+				if ev := nextEvent[MessageEvent](t, session); ev.Message.Text != "still there?" {
+					t.Errorf("received %+v", ev.Message)
+				}
+			})
+
+			t.Run("fingerprint mismatch", func(t *testing.T) {
+				srv := srvCase.start(t, true)
+				opts := srv.options(t)
+				opts.Config.Transport = srvCase.transport
+				opts.Config.ExpectedFP = strings.Repeat("0", 64)
+
+				_, err := Dial(context.Background(), opts)
+				if !errors.Is(err, ErrFingerprintMismatch) {
+					t.Fatalf("Dial() error = %v, want %v", err, ErrFingerprintMismatch)
+				}
+				if Retryable(err) {
+					t.Error("fingerprint mismatch is retryable")
+				}
+				select {
+				case <-srv.conns:
+					t.Error("server received frames from an unverified connection")
+				default:
+				}
+			})
+		})
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	tests := []struct {
+		transport string
+		want      Transport
+		wantErr   bool
+	}{
+		{transport: "", want: TLSTransport{}},
+		{transport: "tls", want: TLSTransport{}},
+		{transport: "websocket", want: WebSocketTransport{}},
+		{transport: "carrier-pigeon", wantErr: true},
+	}
+	for _, tt := range tests {
+		cfg := config.NewConfig()
+		cfg.Transport = tt.transport
+		got, err := NewTransport(cfg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewTransport(%q) error = %v, wantErr %v", tt.transport, err, tt.wantErr)
+			continue
+		}
+		if err == nil && fmt.Sprintf("%T", got) != fmt.Sprintf("%T", tt.want) {
+			t.Errorf("NewTransport(%q) = %T, want %T", tt.transport, got, tt.want)
+		}
+	}
+}
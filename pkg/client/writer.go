@@ -0,0 +1,158 @@
+package client
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"silent_chat/pkg/protocol"
+)
+
+var (
+	// ErrQueueFull is returned when the chat send queue is at capacity.
+	ErrQueueFull = errors.New("send queue full")
+	// ErrSessionClosed is returned for frames sent after the session closed.
+	ErrSessionClosed = errors.New("session closed")
+)
+
+const defaultSendQueueSize = 64
+
+// outgoing is a frame waiting for the writer goroutine. The result of the
+// write is delivered on result, which has room for one value.
+type outgoing struct {
+	msg    protocol.Message
+	result chan error
+}
+
+// isBulk reports whether frames of the given type go through the chat lane,
+// which is bounded and delayed by the send jitter. All other frames are
+// control frames and are written ahead of any queued chat.
+func isBulk(typ string) bool {
+	return typ == "chat" || typ == "fake"
+}
+
+// enqueue hands msg to the writer goroutine.
+func (s *Session) enqueue(msg protocol.Message) (<-chan error, error) {
+	item := outgoing{result: make(chan error, 1)}
+
+	select {
+	case <-s.done:
+		return nil, ErrSessionClosed
+	default:
+	}
+
+	if !isBulk(msg.Type) {
+		item.msg = msg
+		s.metrics.queueChanged(1)
+		select {
+		case s.control <- item:
+			return item.result, nil
+		case <-s.done:
+			s.metrics.queueChanged(-1)
+			return nil, ErrSessionClosed
+		}
+	}
+
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+
+	// Only senders add to the lane and they hold queueMu, so a free slot
+	// cannot disappear before the send below.
+	if len(s.bulk) == cap(s.bulk) {
+		return nil, ErrQueueFull
+	}
+	item.msg = msg
+	s.metrics.queueChanged(1)
+	s.bulk <- item
+	return item.result, nil
+}
+
+// writeLoop is the only writer of the connection once the session has
+// started. Control frames always go first; chat frames wait for a random
+// delay of up to Config.SendJitter, during which control frames still flow.
+func (s *Session) writeLoop() {
+	defer s.drainQueues()
+
+	for {
+		select {
+		case item := <-s.control:
+			s.write(item)
+			continue
+		default:
+		}
+
+		select {
+		case <-s.done:
+			return
+		case item := <-s.control:
+			s.write(item)
+		case item := <-s.bulk:
+			if !s.jitter() {
+				s.metrics.queueChanged(-1)
+				item.result <- ErrSessionClosed
+				return
+			}
+			s.write(item)
+		}
+	}
+}
+
+// jitter waits a random part of Config.SendJitter while serving control
+// frames. It returns false if the session closes in the meantime.
+func (s *Session) jitter() bool {
+	if s.config.SendJitter <= 0 {
+		return true
+	}
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(s.config.SendJitter))))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case item := <-s.control:
+			s.write(item)
+		case <-s.done:
+			return false
+		}
+	}
+}
+
+// write sends one frame and reports the result. A write failure closes the
+// session. Chat messages are linked into the transcript chain here, so the
+// chain order matches the write order, and only a message that was written
+// becomes the head of the chain.
+func (s *Session) write(item outgoing) {
+	s.metrics.queueChanged(-1)
+	chat := item.msg.Type == "chat"
+	if chat {
+		s.transcript.Stamp(&item.msg)
+	}
+	err := s.writeMessage(item.msg)
+	if err != nil {
+		s.logger.Warn("write failed", "type", item.msg.Type, "err", err)
+		s.shutdown(err)
+	} else {
+		if chat {
+			s.transcript.Commit(item.msg)
+		}
+		s.logger.Debug("frame sent", "type", item.msg.Type)
+	}
+	item.result <- err
+}
+
+// drainQueues fails every frame still queued when the session closes.
+func (s *Session) drainQueues() {
+	for {
+		select {
+		case item := <-s.control:
+			s.metrics.queueChanged(-1)
+			item.result <- ErrSessionClosed
+		case item := <-s.bulk:
+			s.metrics.queueChanged(-1)
+			item.result <- ErrSessionClosed
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"silent_chat/pkg/config"
+	"silent_chat/pkg/protocol"
+)
+
+func TestWriterControlFramesSkipChat(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.SendJitter = time.Hour
+	s, sc := newPipeSession(t, cfg)
+
+	chat, err := s.SendAsync(protocol.Message{Type: "chat", Text: "slow"})
+	if err != nil {
+		t.Fatalf("SendAsync(chat) error = %v", err)
+	}
+	ping, err := s.SendAsync(protocol.Message{Type: "ping"})
+	if err != nil {
+		t.Fatalf("SendAsync(ping) error = %v", err)
+	}
+
+	got := sc.readType("ping")
+	if got.Nonce != "nonce" || got.Seq != 1 {
+		t.Errorf("ping frame = %+v, want nonce and seq 1", got)
+	}
+	select {
+	case err := <-ping:
+		if err != nil {
+			t.Errorf("ping result = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result for ping")
+	}
+
+	s.Close()
+	select {
+	case err := <-chat:
+		if !errors.Is(err, ErrSessionClosed) {
+			t.Errorf("chat result = %v, want %v", err, ErrSessionClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result for queued chat after close")
+	}
+}
+
+func TestWriterQueueFull(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.SendJitter = time.Hour
+	cfg.SendQueueSize = 1
+	s, _ := newPipeSession(t, cfg)
+
+	if _, err := s.SendAsync(protocol.Message{Type: "chat", Text: "one"}); err != nil {
+		t.Fatalf("SendAsync(one) error = %v", err)
+	}
+	// Wait for the writer to pick up the first message and hold it in the jitter.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.bulk) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("writer did not dequeue the first message")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := s.SendAsync(protocol.Message{Type: "chat", Text: "two"}); err != nil {
+		t.Fatalf("SendAsync(two) error = %v", err)
+	}
+	if _, err := s.SendAsync(protocol.Message{Type: "chat", Text: "three"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("SendAsync(three) error = %v, want %v", err, ErrQueueFull)
+	}
+}
@@ -5,31 +5,64 @@ import "time"
 // Config represents the configuration settings for the chat application.
 // It includes network parameters, timeouts, retry strategies, and security settings.
 type Config struct {
-	MaxPacketSize         uint32        // Maximum packet size in bytes (default 65536)
-	AbsoluteMaxPacketSize uint32        // Absolute maximum packet size (default 10MB)
-	AuthTimeout           time.Duration // Authentication timeout (default 5 seconds)
-	ReconnectDelay        time.Duration // Delay before reconnecting (default 5 seconds)
-	AuthFailDelay         time.Duration // Delay after authentication failure (default 1 second)
-	ReadTimeout           time.Duration // Read timeout (default 0 - no timeout)
-	MaxRetries            int           // Maximum number of retries (default 5)
-	BackoffIncrement      time.Duration // Backoff increment (default 2 seconds)
-	ExpectedFP            string        // Expected certificate fingerprint for verification
-	Addr                  string        // Server address for connection
-	DialTimeout           time.Duration // Timeout for TLS dial (default 15 seconds)
+	MaxPacketSize           uint32        // Maximum packet size in bytes (default 65536)
+	AbsoluteMaxPacketSize   uint32        // Absolute maximum packet size (default 10MB)
+	AuthTimeout             time.Duration // Authentication timeout (default 5 seconds)
+	ReconnectDelay          time.Duration // Base delay of the exponential reconnect backoff (default 1 second)
+	MaxReconnectDelay       time.Duration // Upper bound of the reconnect backoff (default 1 minute)
+	AuthFailDelay           time.Duration // Delay after authentication failure (default 1 second)
+	ReadTimeout             time.Duration // Read timeout (default 0 - no timeout)
+	MaxRetries              int           // Consecutive failed reconnects before giving up (default 0 - never give up)
+	CircuitBreakerThreshold int           // Consecutive failures after which reconnecting pauses (default 10, 0 disables)
+	CircuitBreakerCooldown  time.Duration // Pause once the circuit breaker opens (default 5 minutes)
+	ExpectedFP              string        // Expected certificate fingerprint for verification
+	BackupFPs               []string      // Further accepted fingerprints, e.g. during a certificate rotation
+	Addr                    string        // Server address for connection
+	Host                    string        // Server host pre-filled in the login form
+	Port                    string        // Server port pre-filled in the login form
+	Username                string        // Username pre-filled in the login form
+	DialTimeout             time.Duration // Timeout for TLS dial (default 15 seconds)
+	Endpoints               []string      // Fallback servers as host:port, tried after the one entered at login
+	EndpointAttemptDelay    time.Duration // Head start of each endpoint before the next one is tried in parallel (default 250ms)
+	PrimaryProbeInterval    time.Duration // How often to check whether the primary endpoint recovered while on a fallback (default 1 minute, 0 disables)
+	Transport               string        // "tls" for raw TLS (default) or "websocket" for WebSocket over HTTPS
+	WebSocketPath           string        // Request path of the WebSocket endpoint (default "/ws")
+	Proxy                   string        // Proxy URL: socks5://, socks5h:// (remote DNS) or http:// CONNECT (empty connects directly)
+	ProxyIsolation          bool          // Use fresh SOCKS credentials per session so Tor isolates its circuit (default false)
+	HistoryPath             string        // Encrypted local history file (empty disables history)
+	OutboxPath              string        // File keeping unsent messages across restarts (empty keeps them in memory)
+	WipePaths               []string      // Key, config and log files securely deleted by /wipe
+	Contacts                []string      // Known usernames; senders imitating one are flagged as lookalikes
+	RequireReplayProtection bool          // Refuse servers that issue no session nonce in auth_result (default false)
+	ShutdownTimeout         time.Duration // Time allowed for a graceful shutdown (default 2 seconds)
+	SendLeave               bool          // Send a "leave" message on graceful shutdown (default false)
+	SendQueueSize           int           // Chat frames queued for the writer before sends fail (default 64)
+	SendJitter              time.Duration // Maximum random delay before each chat frame (default 300ms)
+	Theme                   string        // Color theme: "nord" (default), "light" or "mono"
 }
 
 // NewConfig creates a new Config instance with default values.
 // It initializes all fields with sensible defaults for a chat application.
 func NewConfig() *Config {
 	return &Config{
-		MaxPacketSize:         65536,
-		AbsoluteMaxPacketSize: 10 * 1024 * 1024,
-		AuthTimeout:           5 * time.Second,
-		ReconnectDelay:        5 * time.Second,
-		AuthFailDelay:         1 * time.Second,
-		ReadTimeout:           0,
-		MaxRetries:            5,
-		BackoffIncrement:      2 * time.Second,
-		DialTimeout:           15 * time.Second,
+		MaxPacketSize:           65536,
+		AbsoluteMaxPacketSize:   10 * 1024 * 1024,
+		AuthTimeout:             5 * time.Second,
+		ReconnectDelay:          1 * time.Second,
+		MaxReconnectDelay:       1 * time.Minute,
+		AuthFailDelay:           1 * time.Second,
+		ReadTimeout:             0,
+		MaxRetries:              0,
+		CircuitBreakerThreshold: 10,
+		CircuitBreakerCooldown:  5 * time.Minute,
+		DialTimeout:             15 * time.Second,
+		EndpointAttemptDelay:    250 * time.Millisecond,
+		PrimaryProbeInterval:    1 * time.Minute,
+		Transport:               "tls",
+		WebSocketPath:           "/ws",
+		ShutdownTimeout:         2 * time.Second,
+		SendQueueSize:           64,
+		SendJitter:              300 * time.Millisecond,
+		Theme:                   "nord",
 	}
 }
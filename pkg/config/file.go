@@ -0,0 +1,209 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// File is the TOML configuration file. It holds named server profiles:
+//
+//	default_profile = "work"
+//
+//	[profiles.work]
+//	host = "chat.example.com"
+//	port = 4000
+//	username = "alice"
+//	fingerprints = ["<sha256 hex>"]
+type File struct {
+	DefaultProfile string             `toml:"default_profile"`
+	Profiles       map[string]Profile `toml:"profiles"`
+}
+
+// Profile describes one server and how to connect to it. Fields left out
+// of the file keep their previous value when the profile is applied.
+type Profile struct {
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	Username string `toml:"username"`
+	// Fingerprints pins the server certificate. The first entry is the
+	// current certificate; further entries are accepted too, for example
+	// while the server rotates to a new certificate.
+	Fingerprints   []string      `toml:"fingerprints"`
+	Endpoints      []string      `toml:"endpoints"`
+	Transport      string        `toml:"transport"`
+	WebSocketPath  string        `toml:"websocket_path"`
+	Proxy          string        `toml:"proxy"`
+	ProxyIsolation *bool         `toml:"proxy_isolation"`
+	DialTimeout    time.Duration `toml:"dial_timeout"`
+	AuthTimeout    time.Duration `toml:"auth_timeout"`
+	ReadTimeout    time.Duration `toml:"read_timeout"`
+	HistoryFile    string        `toml:"history_file"`
+	OutboxFile     string        `toml:"outbox_file"`
+	Theme          string        `toml:"theme"`
+	// Contacts lists the usernames of people the user talks to. A sender
+	// whose name looks like one of them but differs is flagged.
+	Contacts []string `toml:"contacts"`
+}
+
+// DefaultFilePath returns the configuration file location under the XDG
+// config directory, $XDG_CONFIG_HOME/silent_chat/config.toml, falling back
+// to ~/.config.
+func DefaultFilePath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" || !filepath.IsAbs(dir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find config directory: %v", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "silent_chat", "config.toml"), nil
+}
+
+// LoadFile reads and validates the configuration file at path. Unknown
+// settings are reported as errors so that typos do not go unnoticed. If the
+// file does not exist, the error wraps fs.ErrNotExist.
+func LoadFile(path string) (*File, error) {
+	var f File
+	meta, err := toml.DecodeFile(path, &f)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("config file %s: unknown setting %q", path, undecoded[0].String())
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+	return &f, nil
+}
+
+// Validate checks the values that can be checked without connecting.
+func (f *File) Validate() error {
+	if f.DefaultProfile != "" {
+		if _, ok := f.Profiles[f.DefaultProfile]; !ok {
+			return fmt.Errorf("default_profile %q is not defined", f.DefaultProfile)
+		}
+	}
+	for _, name := range f.ProfileNames() {
+		p := f.Profiles[name]
+		if p.Port < 0 || p.Port > 65535 {
+			return fmt.Errorf("profile %q: port must be a number between 1 and 65535", name)
+		}
+		for _, fp := range p.Fingerprints {
+			if _, err := NormalizeFingerprint(fp); err != nil {
+				return fmt.Errorf("profile %q: %v", name, err)
+			}
+		}
+		for _, d := range []time.Duration{p.DialTimeout, p.AuthTimeout, p.ReadTimeout} {
+			if d < 0 {
+				return fmt.Errorf("profile %q: timeouts must not be negative", name)
+			}
+		}
+	}
+	return nil
+}
+
+// ProfileNames returns the names of the profiles in sorted order.
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Profile returns the named profile, or the default profile if name is
+// empty. It returns false if name is empty and there is no default.
+func (f *File) Profile(name string) (Profile, bool, error) {
+	if name == "" {
+		name = f.DefaultProfile
+		if name == "" {
+			return Profile{}, false, nil
+		}
+	}
+	p, ok := f.Profiles[name]
+	if !ok {
+		return Profile{}, false, fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(f.ProfileNames(), ", "))
+	}
+	return p, true, nil
+}
+
+// Apply copies the settings of the profile into cfg. Settings the profile
+// leaves out are not changed.
+func (p Profile) Apply(cfg *Config) {
+	setString := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	setDuration := func(dst *time.Duration, v time.Duration) {
+		if v != 0 {
+			*dst = v
+		}
+	}
+
+	setString(&cfg.Host, p.Host)
+	if p.Port != 0 {
+		cfg.Port = strconv.Itoa(p.Port)
+	}
+	setString(&cfg.Username, p.Username)
+	if len(p.Fingerprints) > 0 {
+		pins := make([]string, len(p.Fingerprints))
+		for i, fp := range p.Fingerprints {
+			pins[i], _ = NormalizeFingerprint(fp)
+		}
+		cfg.ExpectedFP, cfg.BackupFPs = pins[0], pins[1:]
+	}
+	if len(p.Endpoints) > 0 {
+		cfg.Endpoints = p.Endpoints
+	}
+	setString(&cfg.Transport, p.Transport)
+	setString(&cfg.WebSocketPath, p.WebSocketPath)
+	setString(&cfg.Proxy, p.Proxy)
+	if p.ProxyIsolation != nil {
+		cfg.ProxyIsolation = *p.ProxyIsolation
+	}
+	setDuration(&cfg.DialTimeout, p.DialTimeout)
+	setDuration(&cfg.AuthTimeout, p.AuthTimeout)
+	setDuration(&cfg.ReadTimeout, p.ReadTimeout)
+	setString(&cfg.HistoryPath, expandHome(p.HistoryFile))
+	setString(&cfg.OutboxPath, expandHome(p.OutboxFile))
+	setString(&cfg.Theme, p.Theme)
+	if len(p.Contacts) > 0 {
+		cfg.Contacts = p.Contacts
+	}
+}
+
+// expandHome replaces a leading "~/" with the home directory.
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
+
+// NormalizeFingerprint accepts a SHA-256 certificate fingerprint in hex,
+// with or without colons, and returns it in the lowercase hex form used by
+// Config.ExpectedFP.
+func NormalizeFingerprint(fp string) (string, error) {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+	if b, err := hex.DecodeString(normalized); err != nil || len(b) != 32 {
+		return "", fmt.Errorf("invalid fingerprint %q: want 64 hex digits", fp)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testFP       = "aabbccddeeff00112233445566778899aabbccddeeff00112233445566778899"
+	testFPColons = "AA:BB:CC:DD:EE:FF:00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33:44:55:66:77:88:99"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfig(t, `
+default_profile = "work"
+
+[profiles.work]
+host = "chat.example.com"
+port = 4000
+username = "alice"
+fingerprints = ["`+testFPColons+`", "`+strings.Repeat("1", 64)+`"]
+endpoints = ["backup.example.com:4000", "[2001:db8::2]"]
+proxy = "socks5h://127.0.0.1:9050"
+proxy_isolation = true
+dial_timeout = "30s"
+theme = "mono"
+contacts = ["bob", "carol"]
+
+[profiles.home]
+host = "10.0.0.2"
+`)
+	file, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if got := strings.Join(file.ProfileNames(), ","); got != "home,work" {
+		t.Errorf("ProfileNames() = %q", got)
+	}
+
+	profile, ok, err := file.Profile("")
+	if err != nil || !ok {
+		t.Fatalf("Profile(\"\") = %v, %v", ok, err)
+	}
+	cfg := NewConfig()
+	profile.Apply(cfg)
+
+	if cfg.Host != "chat.example.com" || cfg.Port != "4000" || cfg.Username != "alice" {
+		t.Errorf("login = %s:%s as %s", cfg.Host, cfg.Port, cfg.Username)
+	}
+	if cfg.ExpectedFP != testFP {
+		t.Errorf("ExpectedFP = %q, want %q", cfg.ExpectedFP, testFP)
+	}
+	if len(cfg.BackupFPs) != 1 || cfg.BackupFPs[0] != strings.Repeat("1", 64) {
+		t.Errorf("BackupFPs = %v", cfg.BackupFPs)
+	}
+	if len(cfg.Endpoints) != 2 || !cfg.ProxyIsolation || cfg.Proxy != "socks5h://127.0.0.1:9050" {
+		t.Errorf("Endpoints = %v, Proxy = %q, ProxyIsolation = %v", cfg.Endpoints, cfg.Proxy, cfg.ProxyIsolation)
+	}
+	if cfg.DialTimeout != 30*time.Second || cfg.Theme != "mono" {
+		t.Errorf("DialTimeout = %v, Theme = %q", cfg.DialTimeout, cfg.Theme)
+	}
+	if strings.Join(cfg.Contacts, ",") != "bob,carol" {
+		t.Errorf("Contacts = %v", cfg.Contacts)
+	}
+	// Settings left out of the profile keep their defaults.
+	if defaults := NewConfig(); cfg.AuthTimeout != defaults.AuthTimeout || cfg.Transport != defaults.Transport {
+		t.Errorf("AuthTimeout = %v, Transport = %q, want defaults", cfg.AuthTimeout, cfg.Transport)
+	}
+
+	home, _, err := file.Profile("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = NewConfig()
+	home.Apply(cfg)
+	if cfg.Host != "10.0.0.2" || cfg.Port != "" || cfg.ExpectedFP != "" {
+		t.Errorf("home profile: host %q, port %q, fingerprint %q", cfg.Host, cfg.Port, cfg.ExpectedFP)
+	}
+
+	if _, _, err := file.Profile("office"); err == nil {
+		t.Error("Profile() accepted an unknown profile")
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "syntax", content: `[profiles.work`, want: "config.toml"},
+		{name: "unknown setting", content: "[profiles.work]\nhots = \"x\"", want: "profiles.work.hots"},
+		{name: "bad fingerprint", content: "[profiles.work]\nfingerprints = [\"abc\"]", want: "invalid fingerprint"},
+		{name: "bad port", content: "[profiles.work]\nport = 70000", want: "port"},
+		{name: "bad duration", content: "[profiles.work]\ndial_timeout = \"soon\"", want: "dial_timeout"},
+		{name: "missing default", content: "default_profile = \"work\"", want: "not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFile(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadFile() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	_, err := LoadFile(filepath.Join(t.TempDir(), "missing.toml"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LoadFile(missing) error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestNoDefaultProfile(t *testing.T) {
+	file, err := LoadFile(writeConfig(t, "[profiles.work]\nhost = \"a\""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := file.Profile(""); ok || err != nil {
+		t.Errorf("Profile(\"\") = %v, %v, want no profile", ok, err)
+	}
+}
+
+func TestDefaultFilePath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if got, _ := DefaultFilePath(); got != "/xdg/silent_chat/config.toml" {
+		t.Errorf("DefaultFilePath() = %q", got)
+	}
+	t.Setenv("XDG_CONFIG_HOME", "relative")
+	t.Setenv("HOME", "/home/alice")
+	if got, _ := DefaultFilePath(); got != "/home/alice/.config/silent_chat/config.toml" {
+		t.Errorf("DefaultFilePath() = %q", got)
+	}
+}
@@ -0,0 +1,477 @@
+// Package history provides an opt-in encrypted local message history.
+// Messages are appended to a single file, each record sealed with a key
+// derived from a passphrase by package secret. The key only lives in memory
+// and is never written to disk.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"silent_chat/internal/secret"
+	"silent_chat/internal/utils"
+)
+
+const (
+	magic      = "SCHIST01"
+	headerSize = len(magic) + secret.ParamsSize
+	maxRecord  = 1 << 20
+
+	checkPlaintext = "silent_chat history"
+	slotSize       = 4 + len(checkPlaintext) + secret.Overhead
+
+	// Records 0 and 1 are the key check slots for the real and the duress
+	// passphrase. Message entries start at record 2.
+	realSlot   = 0
+	duressSlot = 1
+)
+
+var (
+	// ErrWrongPassphrase is returned by Open when the passphrase does not decrypt the store.
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted history")
+	// ErrDecoy is returned by operations that are not available in a decoy profile.
+	ErrDecoy = errors.New("not available in this profile")
+)
+
+// Entry is a single message stored in the history.
+type Entry struct {
+	ID        string `json:"id,omitempty"`
+	Sender    string `json:"sender"`
+	Text      string `json:"text"`
+	Time      int64  `json:"time"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the entry has a disappearing message timer that has elapsed.
+func (e Entry) Expired(now time.Time) bool {
+	return e.ExpiresAt > 0 && now.Unix() >= e.ExpiresAt
+}
+
+// marshalHeader encodes the file header: the magic followed by the key
+// derivation parameters.
+func marshalHeader(params secret.Params) []byte {
+	return append([]byte(magic), params.Marshal()...)
+}
+
+func parseHeader(buf []byte) (secret.Params, error) {
+	if len(buf) != headerSize || string(buf[:len(magic)]) != magic {
+		return secret.Params{}, fmt.Errorf("not a history file")
+	}
+	params, err := secret.ParseParams(buf[len(magic):])
+	if err != nil {
+		return secret.Params{}, fmt.Errorf("invalid history header: %w", err)
+	}
+	return params, nil
+}
+
+// Store is an append-only encrypted message history backed by a file.
+// It is safe for concurrent use.
+//
+// The file holds two key check slots. The second one is either random bytes
+// or sealed with a duress passphrase; opening the store with the duress
+// passphrase unlocks an empty in-memory decoy profile and leaves the real
+// history untouched. Both layouts are indistinguishable without a passphrase.
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	params  secret.Params
+	aead    cipher.AEAD
+	records uint64
+	entries []Entry
+	slots   [2][]byte
+	decoy   bool
+}
+
+// Open opens the history file at path, creating it if it does not exist, and
+// decrypts all entries with a key derived from passphrase. Expired entries are
+// dropped from the file. The caller may wipe passphrase after Open returns.
+// If passphrase is the duress passphrase, an empty decoy Store is returned.
+func Open(path string, passphrase []byte) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create history dir: %v", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %v", err)
+	}
+
+	s := &Store{path: path, file: file}
+	if err := s.load(passphrase); err != nil {
+		s.closeLocked()
+		return nil, err
+	}
+	if err := s.Prune(time.Now()); err != nil {
+		s.closeLocked()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) load(passphrase []byte) error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat history: %v", err)
+	}
+
+	if info.Size() == 0 {
+		if s.params, err = secret.NewParams(); err != nil {
+			return err
+		}
+		if err := s.deriveKey(passphrase); err != nil {
+			return err
+		}
+		if s.slots[realSlot], err = s.seal([]byte(checkPlaintext), realSlot); err != nil {
+			return err
+		}
+		s.slots[duressSlot] = make([]byte, slotSize)
+		binary.BigEndian.PutUint32(s.slots[duressSlot], uint32(slotSize-4))
+		if _, err := rand.Read(s.slots[duressSlot][4:]); err != nil {
+			return err
+		}
+		s.records = 2
+
+		var buf bytes.Buffer
+		buf.Write(marshalHeader(s.params))
+		buf.Write(s.slots[realSlot])
+		buf.Write(s.slots[duressSlot])
+		if _, err := s.file.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to write history: %v", err)
+		}
+		return nil
+	}
+
+	r := bufio.NewReader(s.file)
+	hdr := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return fmt.Errorf("failed to read history header: %v", err)
+	}
+	if s.params, err = parseHeader(hdr); err != nil {
+		return err
+	}
+	if err := s.deriveKey(passphrase); err != nil {
+		return err
+	}
+
+	for i := range s.slots {
+		s.slots[i] = make([]byte, slotSize)
+		if _, err := io.ReadFull(r, s.slots[i]); err != nil {
+			return fmt.Errorf("failed to read history header: %v", err)
+		}
+	}
+
+	if check, err := s.open(s.slots[realSlot][4:], realSlot); err != nil || string(check) != checkPlaintext {
+		if check, err := s.open(s.slots[duressSlot][4:], duressSlot); err == nil && string(check) == checkPlaintext {
+			s.decoy = true
+			return nil
+		}
+		return ErrWrongPassphrase
+	}
+	s.records = 2
+
+	for {
+		plain, err := s.readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var entry Entry
+		if err := json.Unmarshal(plain, &entry); err != nil {
+			return fmt.Errorf("failed to decode history entry: %v", err)
+		}
+		s.entries = append(s.entries, entry)
+	}
+}
+
+func (s *Store) deriveKey(passphrase []byte) error {
+	aead, err := s.params.AEAD(passphrase)
+	if err != nil {
+		return err
+	}
+	s.aead = aead
+	return nil
+}
+
+// additionalData binds a record to its file and position so records cannot
+// be reordered or moved between history files.
+func (s *Store) additionalData(index uint64) []byte {
+	ad := append([]byte(magic), s.params.Salt...)
+	return binary.BigEndian.AppendUint64(ad, index)
+}
+
+// seal encrypts plain as the record at index and returns it with its length prefix.
+func (s *Store) seal(plain []byte, index uint64) ([]byte, error) {
+	sealed, err := secret.Seal(s.aead, plain, s.additionalData(index))
+	if err != nil {
+		return nil, err
+	}
+	buf := binary.BigEndian.AppendUint32(nil, uint32(len(sealed)))
+	return append(buf, sealed...), nil
+}
+
+// open decrypts a sealed record without its length prefix.
+func (s *Store) open(sealed []byte, index uint64) ([]byte, error) {
+	plain, err := secret.Open(s.aead, sealed, s.additionalData(index))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plain, nil
+}
+
+// writeRecord seals plain as the record at index and writes it to w.
+func (s *Store) writeRecord(w io.Writer, plain []byte, index uint64) error {
+	record, err := s.seal(plain, index)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(record); err != nil {
+		return fmt.Errorf("failed to write history: %v", err)
+	}
+	return nil
+}
+
+func (s *Store) readRecord(r io.Reader) ([]byte, error) {
+	lenBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, lenBuf); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("truncated history record: %v", err)
+	}
+	size := binary.BigEndian.Uint32(lenBuf)
+	if size > maxRecord || size < secret.Overhead {
+		return nil, fmt.Errorf("invalid history record size: %d", size)
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(r, sealed); err != nil {
+		return nil, fmt.Errorf("truncated history record: %v", err)
+	}
+	plain, err := s.open(sealed, s.records)
+	if err != nil {
+		return nil, err
+	}
+	s.records++
+	return plain, nil
+}
+
+// Append encrypts an entry and appends it to the history file.
+func (s *Store) Append(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("history is closed")
+	}
+	if s.decoy {
+		s.entries = append(s.entries, entry)
+		return nil
+	}
+	plain, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %v", err)
+	}
+	if err := s.writeRecord(s.file, plain, s.records); err != nil {
+		return err
+	}
+	s.records++
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Entries returns all entries that have not expired, oldest first.
+func (s *Store) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	result := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		if !e.Expired(now) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Search returns the entries whose sender or text contains query, ignoring case.
+func (s *Store) Search(query string) []Entry {
+	query = strings.ToLower(query)
+	var result []Entry
+	for _, e := range s.Entries() {
+		if strings.Contains(strings.ToLower(e.Text), query) ||
+			strings.Contains(strings.ToLower(e.Sender), query) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Prune removes entries whose disappearing message timer has elapsed. If any
+// are found, the file is rewritten without them and atomically replaced.
+func (s *Store) Prune(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("history is closed")
+	}
+
+	kept := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		if !e.Expired(now) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == len(s.entries) {
+		return nil
+	}
+	if s.decoy {
+		s.entries = kept
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".history-*")
+	if err != nil {
+		return fmt.Errorf("failed to compact history: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// s.records keeps describing the current file until it is replaced.
+	records := uint64(2)
+	w := bufio.NewWriter(tmp)
+	w.Write(marshalHeader(s.params))
+	w.Write(s.slots[realSlot])
+	if _, err := w.Write(s.slots[duressSlot]); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact history: %v", err)
+	}
+	for _, e := range kept {
+		plain, err := json.Marshal(e)
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to encode history entry: %v", err)
+		}
+		if err := s.writeRecord(w, plain, records); err != nil {
+			tmp.Close()
+			return err
+		}
+		records++
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact history: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact history: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to compact history: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to compact history: %v", err)
+	}
+
+	// The old file is gone now; never append to it again.
+	s.file.Close()
+	s.file = nil
+	s.records = records
+	s.entries = kept
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to reopen history: %v", err)
+	}
+	s.file = file
+	return nil
+}
+
+// SetDuressPassphrase seals the duress key check slot with a key derived from
+// duress, replacing any previous duress passphrase. It is not available in a
+// decoy profile, and the duress passphrase must differ from the real one.
+func (s *Store) SetDuressPassphrase(duress []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("history is closed")
+	}
+	if s.decoy {
+		return ErrDecoy
+	}
+
+	duressStore := &Store{params: s.params}
+	if err := duressStore.deriveKey(duress); err != nil {
+		return err
+	}
+	defer duressStore.closeLocked()
+	if _, err := duressStore.open(s.slots[realSlot][4:], realSlot); err == nil {
+		return fmt.Errorf("duress passphrase must differ from the history passphrase")
+	}
+
+	slot, err := duressStore.seal([]byte(checkPlaintext), duressSlot)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %v", err)
+	}
+	if _, err := file.WriteAt(slot, int64(headerSize+slotSize)); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write history: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write history: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write history: %v", err)
+	}
+	s.slots[duressSlot] = slot
+	return nil
+}
+
+// Destroy closes the store and securely deletes the history file.
+// It works in a decoy profile too, removing the real history.
+func (s *Store) Destroy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.closeLocked(); err != nil {
+		return err
+	}
+	return utils.SecureDelete(s.path)
+}
+
+// Close closes the history file and drops the key.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeLocked()
+}
+
+func (s *Store) closeLocked() error {
+	s.aead = nil
+	s.entries = nil
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
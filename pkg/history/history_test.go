@@ -0,0 +1,255 @@
+package history
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"silent_chat/internal/secret"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.bin")
+	pass := []byte("correct horse")
+
+	store, err := Open(path, pass)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	entries := []Entry{
+		{ID: "1", Sender: "alice", Text: "hello bob", Time: 1},
+		{ID: "2", Sender: "bob", Text: "Hi Alice", Time: 2},
+	}
+	for _, e := range entries {
+		if err := store.Append(e); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("hello bob")) || bytes.Contains(raw, pass) {
+		t.Error("history file contains plaintext")
+	}
+
+	store, err = Open(path, pass)
+	if err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	defer store.Close()
+
+	got := store.Entries()
+	if len(got) != len(entries) {
+		t.Fatalf("Entries() returned %d entries, want %d", len(got), len(entries))
+	}
+	for i := range entries {
+		if got[i] != entries[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], entries[i])
+		}
+	}
+
+	found := store.Search("alice")
+	if len(found) != 2 {
+		t.Errorf("Search(alice) returned %d entries, want 2", len(found))
+	}
+}
+
+func TestStoreWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.bin")
+	store, err := Open(path, []byte("right"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	if _, err := Open(path, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Open() with wrong passphrase = %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestStoreCorruptedHeader(t *testing.T) {
+	params := len(magic) + secret.SaltSize
+	tests := []struct {
+		name   string
+		offset int
+		value  []byte
+	}{
+		{name: "zero time", offset: params, value: []byte{0, 0, 0, 0}},
+		{name: "huge memory", offset: params + 4, value: []byte{0xff, 0xff, 0xff, 0xff}},
+		{name: "zero threads", offset: params + 8, value: []byte{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history.bin")
+			store, err := Open(path, []byte("pass"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			store.Close()
+
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			copy(raw[tt.offset:], tt.value)
+			if err := os.WriteFile(path, raw, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Open(path, []byte("pass")); !errors.Is(err, secret.ErrInvalidParams) {
+				t.Errorf("Open() error = %v, want %v", err, secret.ErrInvalidParams)
+			}
+		})
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.bin")
+	pass := []byte("pass")
+	store, err := Open(path, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	store.Append(Entry{Sender: "a", Text: "keep"})
+	store.Append(Entry{Sender: "a", Text: "gone", ExpiresAt: now.Add(time.Minute).Unix()})
+	store.Append(Entry{Sender: "a", Text: "also kept"})
+
+	if err := store.Prune(now.Add(2 * time.Minute)); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	store.Append(Entry{Sender: "a", Text: "after prune"})
+	store.Close()
+
+	store, err = Open(path, pass)
+	if err != nil {
+		t.Fatalf("reopen after prune error = %v", err)
+	}
+	defer store.Close()
+
+	var texts []string
+	for _, e := range store.Entries() {
+		texts = append(texts, e.Text)
+	}
+	want := []string{"keep", "also kept", "after prune"}
+	if len(texts) != len(want) {
+		t.Fatalf("entries = %q, want %q", texts, want)
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			t.Errorf("entries = %q, want %q", texts, want)
+		}
+	}
+}
+
+func TestStorePruneFailureKeepsStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.bin")
+	backup := filepath.Join(dir, "history.link")
+	pass := []byte("pass")
+	store, err := Open(path, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	store.Append(Entry{Sender: "a", Text: "keep"})
+	store.Append(Entry{Sender: "a", Text: "gone", ExpiresAt: now.Add(time.Minute).Unix()})
+
+	// Make the final rename fail by putting a non-empty directory where the
+	// history was; the open file stays reachable through a hard link.
+	if err := os.Link(path, backup); err != nil {
+		t.Skipf("hard links unavailable: %v", err)
+	}
+	os.Remove(path)
+	if err := os.MkdirAll(filepath.Join(path, "blocker"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Prune(now.Add(2 * time.Minute)); err == nil {
+		t.Fatal("Prune() succeeded despite the blocked rename")
+	}
+	if err := store.Append(Entry{Sender: "a", Text: "after failed prune"}); err != nil {
+		t.Fatalf("Append() after failed Prune error = %v", err)
+	}
+	store.Close()
+
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(backup, path); err != nil {
+		t.Fatal(err)
+	}
+	store, err = Open(path, pass)
+	if err != nil {
+		t.Fatalf("reopen after failed prune error = %v", err)
+	}
+	defer store.Close()
+	entries := store.Entries()
+	if len(entries) == 0 || entries[len(entries)-1].Text != "after failed prune" {
+		t.Errorf("entries = %+v, want the entry appended after the failed prune", entries)
+	}
+}
+
+func TestStoreDuress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.bin")
+	realPass, duress := []byte("real pass"), []byte("duress pass")
+
+	store, err := Open(path, realPass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetDuressPassphrase(realPass); err == nil {
+		t.Error("SetDuressPassphrase() accepted the real passphrase")
+	}
+	if err := store.SetDuressPassphrase(duress); err != nil {
+		t.Fatalf("SetDuressPassphrase() error = %v", err)
+	}
+	store.Append(Entry{Sender: "alice", Text: "secret"})
+	store.Close()
+
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoy, err := Open(path, duress)
+	if err != nil {
+		t.Fatalf("Open() with duress passphrase error = %v", err)
+	}
+	if got := decoy.Entries(); len(got) != 0 {
+		t.Errorf("decoy profile has %d entries, want 0", len(got))
+	}
+	decoy.Append(Entry{Sender: "alice", Text: "decoy"})
+	if err := decoy.SetDuressPassphrase([]byte("other")); !errors.Is(err, ErrDecoy) {
+		t.Errorf("SetDuressPassphrase() in decoy = %v, want ErrDecoy", err)
+	}
+	decoy.Close()
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("decoy profile modified the history file")
+	}
+
+	store, err = Open(path, realPass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Entries(); len(got) != 1 || got[0].Text != "secret" {
+		t.Errorf("real profile entries = %+v", got)
+	}
+	if err := store.Destroy(); err != nil {
+		t.Fatalf("Destroy() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("history file still exists after Destroy()")
+	}
+}
@@ -0,0 +1,170 @@
+// Package identity stores the user's long-term Ed25519 identity key, the key
+// other users look up in the server's key transparency log (see package
+// transparency).
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"silent_chat/internal/secret"
+	"silent_chat/internal/utils"
+)
+
+// The key file is a PEM block holding the key derivation parameters,
+// followed by the PKCS#8 encoded key sealed with package secret. The PEM
+// type and the parameters are authenticated as additional data.
+const pemType = "SILENT_CHAT ENCRYPTED PRIVATE KEY"
+
+var (
+	// ErrNoKey is returned by Load when there is no key file.
+	ErrNoKey = errors.New("no identity key")
+	// ErrKeyExists is returned by Save when a key file already exists.
+	ErrKeyExists = errors.New("identity key already exists")
+	// ErrWrongPassphrase is returned by Load when the passphrase does not
+	// decrypt the key.
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted identity key")
+)
+
+// Key is an Ed25519 identity key pair.
+type Key struct {
+	Private ed25519.PrivateKey
+}
+
+// Generate creates a new random identity key.
+func Generate() (Key, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to generate identity key: %v", err)
+	}
+	return Key{Private: priv}, nil
+}
+
+// Public returns the public half of the key.
+func (k Key) Public() ed25519.PublicKey {
+	return k.Private.Public().(ed25519.PublicKey)
+}
+
+// Fingerprint returns the lowercase hex SHA256 hash of the public key, for
+// comparing keys out of band.
+func (k Key) Fingerprint() string {
+	sum := sha256.Sum256(k.Public())
+	return hex.EncodeToString(sum[:])
+}
+
+// DefaultPath returns the key file location under the XDG data directory,
+// $XDG_DATA_HOME/silent_chat/identity.pem, falling back to ~/.local/share.
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" || !filepath.IsAbs(dir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find data directory: %v", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "silent_chat", "identity.pem"), nil
+}
+
+// Load reads the key stored at path and decrypts it with passphrase. If
+// there is no file, the error wraps ErrNoKey. The caller may wipe
+// passphrase after Load returns.
+func Load(path string, passphrase []byte) (Key, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Key{}, fmt.Errorf("%w at %s", ErrNoKey, path)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemType || len(block.Bytes) < secret.ParamsSize {
+		return Key{}, fmt.Errorf("%s: not an encrypted identity key", path)
+	}
+	rawParams, sealed := block.Bytes[:secret.ParamsSize], block.Bytes[secret.ParamsSize:]
+	params, err := secret.ParseParams(rawParams)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", path, err)
+	}
+	aead, err := params.AEAD(passphrase)
+	if err != nil {
+		return Key{}, err
+	}
+	der, err := secret.Open(aead, sealed, additionalData(rawParams))
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", path, ErrWrongPassphrase)
+	}
+	defer clear(der)
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %v", path, err)
+	}
+	priv, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return Key{}, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return Key{Private: priv}, nil
+}
+
+// Save encrypts the key with passphrase and writes it to path, readable by
+// the owner only. It never replaces an existing key; delete it first with
+// Delete. The caller may wipe passphrase after Save returns.
+func Save(path string, key Key, passphrase []byte) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return err
+	}
+	defer clear(der)
+
+	params, err := secret.NewParams()
+	if err != nil {
+		return err
+	}
+	aead, err := params.AEAD(passphrase)
+	if err != nil {
+		return err
+	}
+	rawParams := params.Marshal()
+	sealed, err := secret.Seal(aead, der, additionalData(rawParams))
+	if err != nil {
+		return err
+	}
+	sealed = append(rawParams, sealed...)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w at %s", ErrKeyExists, path)
+	}
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: pemType, Bytes: sealed}); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+func additionalData(params []byte) []byte {
+	return append([]byte(pemType), params...)
+}
+
+// Delete overwrites and removes the key file. A missing file is not an error.
+func Delete(path string) error {
+	return utils.SecureDelete(path)
+}
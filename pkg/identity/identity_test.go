@@ -0,0 +1,102 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"silent_chat/internal/secret"
+)
+
+var testPassphrase = []byte("correct horse battery staple")
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "identity.pem")
+
+	if _, err := Load(path, testPassphrase); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("Load() before Save error = %v, want %v", err, ErrNoKey)
+	}
+
+	key, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(path, key, testPassphrase); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("key file mode = %o, want 600", perm)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, key.Private.Seed()) {
+		t.Error("key file contains the private key in plain text")
+	}
+
+	loaded, err := Load(path, testPassphrase)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !loaded.Private.Equal(key.Private) || loaded.Fingerprint() != key.Fingerprint() {
+		t.Error("Load() returned a different key")
+	}
+	if _, err := Load(path, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Load() with wrong passphrase error = %v, want %v", err, ErrWrongPassphrase)
+	}
+
+	other, _ := Generate()
+	if err := Save(path, other, testPassphrase); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("Save() over an existing key error = %v, want %v", err, ErrKeyExists)
+	}
+
+	if err := Delete(path); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := Load(path, testPassphrase); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Load() after Delete error = %v, want %v", err, ErrNoKey)
+	}
+}
+
+func TestLoadRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.pem")
+	if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, testPassphrase); err == nil {
+		t.Error("Load() accepted a file without a PEM key")
+	}
+}
+
+func TestLoadRejectsInvalidParams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.pem")
+	key, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(path, key, testPassphrase); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	// The last parameter byte is the Argon2 thread count.
+	block.Bytes[secret.ParamsSize-1] = 0
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, testPassphrase); !errors.Is(err, secret.ErrInvalidParams) {
+		t.Errorf("Load() error = %v, want %v", err, secret.ErrInvalidParams)
+	}
+}
@@ -0,0 +1,91 @@
+// Package logging sets up structured logging for silent_chat. Records go to
+// a rotating file instead of the terminal, which belongs to the TUI, and
+// attributes that may carry secrets or message content are redacted.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Redacted replaces the value of sensitive attributes.
+const Redacted = "[redacted]"
+
+// sensitiveKeys are attribute keys whose values are never written to the
+// log unless redaction is disabled.
+var sensitiveKeys = map[string]bool{
+	"password":     true,
+	"passphrase":   true,
+	"resume_token": true,
+	"token":        true,
+	"text":         true,
+	"body":         true,
+}
+
+// Options configures New.
+type Options struct {
+	Path       string     // Log file; DefaultPath() if empty
+	Level      slog.Level // Minimum level written (default Info)
+	MaxSize    int64      // Size in bytes at which the file is rotated (default 1MB)
+	MaxBackups int        // Rotated files kept next to the log (default 3)
+	NoRedact   bool       // Write sensitive attributes in clear, for local debugging only
+}
+
+// New returns a logger writing to a rotating file as described by opts.
+// The caller must close the returned file when done logging.
+func New(opts Options) (*slog.Logger, *RotatingFile, error) {
+	path := opts.Path
+	if path == "" {
+		var err error
+		if path, err = DefaultPath(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	file, err := OpenRotatingFile(path, opts.MaxSize, opts.MaxBackups)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	handler := slog.NewTextHandler(file, &slog.HandlerOptions{
+		Level:       opts.Level,
+		ReplaceAttr: replaceAttr(!opts.NoRedact),
+	})
+	return slog.New(handler), file, nil
+}
+
+// NewHandler returns a text handler writing to w with the same redaction
+// rules as New. It is meant for tests and embedding.
+func NewHandler(w io.Writer, level slog.Level) slog.Handler {
+	return slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: replaceAttr(true),
+	})
+}
+
+func replaceAttr(redact bool) func([]string, slog.Attr) slog.Attr {
+	return func(_ []string, a slog.Attr) slog.Attr {
+		if redact && sensitiveKeys[strings.ToLower(a.Key)] {
+			return slog.String(a.Key, Redacted)
+		}
+		return a
+	}
+}
+
+// DefaultPath returns the log file location under the XDG state directory,
+// $XDG_STATE_HOME/silent_chat/client.log, falling back to ~/.local/state.
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" || !filepath.IsAbs(dir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find state directory: %v", err)
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "silent_chat", "client.log"), nil
+}
@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	tests := []struct {
+		name string
+		attr slog.Attr
+		want string
+		hide string
+	}{
+		{name: "password", attr: slog.String("password", "hunter2"), want: "password=" + Redacted, hide: "hunter2"},
+		{name: "message body", attr: slog.String("text", "meet at noon"), want: "text=" + Redacted, hide: "noon"},
+		{name: "nested token", attr: slog.Group("auth", slog.String("resume_token", "abc123")), want: "auth.resume_token=" + Redacted, hide: "abc123"},
+		{name: "harmless", attr: slog.String("type", "chat"), want: "type=chat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			slog.New(NewHandler(&buf, slog.LevelInfo)).Info("event", tt.attr)
+			out := buf.String()
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("log = %q, want %q", out, tt.want)
+			}
+			if tt.hide != "" && strings.Contains(out, tt.hide) {
+				t.Errorf("log = %q leaks %q", out, tt.hide)
+			}
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "client.log")
+	r, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error = %v", err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for file, content := range want {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", file, err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), got, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept more than 2 backups")
+	}
+	if got, want := r.Files(), []string{path, path + ".1", path + ".2"}; !slices.Equal(got, want) {
+		t.Errorf("Files() = %q, want %q", got, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("log file mode = %v, want 0600", perm)
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/tmp/xdg-state")
+	got, err := DefaultPath()
+	if err != nil {
+		t.Fatalf("DefaultPath() error = %v", err)
+	}
+	if want := "/tmp/xdg-state/silent_chat/client.log"; got != want {
+		t.Errorf("DefaultPath() = %q, want %q", got, want)
+	}
+}
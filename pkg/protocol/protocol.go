@@ -5,61 +5,112 @@ package protocol
 import (
 	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"math"
+	"slices"
 	"strings"
 
 	"silent_chat/pkg/config"
 )
 
+// Version is the version of the wire protocol: JSON messages framed with a 4-byte big-endian length prefix.
+const Version = 1
+
 // Message represents a protocol message used in the chat application for communication between client and server.
 // It includes fields for message type, content, sender information, authentication, and status.
 type Message struct {
-	Type       string `json:"type"`
-	Text       string `json:"text,omitempty"`
-	SenderName string `json:"sender_name,omitempty"`
-	SenderIP   string `json:"sender_ip,omitempty"`
-	Password   string `json:"password,omitempty"`
-	Username   string `json:"username,omitempty"`
-	Success    bool   `json:"success,omitempty"`
-	Error      string `json:"error,omitempty"`
+	Type        string `json:"type"`
+	ID          string `json:"id,omitempty"`
+	Text        string `json:"text,omitempty"`
+	SenderName  string `json:"sender_name,omitempty"`
+	SenderIP    string `json:"sender_ip,omitempty"`
+	Password    string `json:"password,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Success     bool   `json:"success,omitempty"`
+	Error       string `json:"error,omitempty"`
+	PrevHash    string `json:"prev_hash,omitempty"`    // Hash of the sender's previous chat message
+	SeenHash    string `json:"seen_hash,omitempty"`    // Hash of the latest message the sender has seen
+	Nonce       string `json:"nonce,omitempty"`        // Session nonce issued by the server in auth_result
+	Seq         uint64 `json:"seq,omitempty"`          // Per-direction monotonic frame counter
+	ExpiresAt   int64  `json:"expires_at,omitempty"`   // Unix time after which the message must be discarded
+	TTL         int64  `json:"ttl,omitempty"`          // Disappearing message timer in seconds, for "timer" messages
+	ResumeToken string `json:"resume_token,omitempty"` // Issued in "auth_result", presented in "auth" to resume a session
+}
+
+var (
+	// ErrFingerprintMismatch is returned by VerifyFingerprint when the server
+	// certificate does not match the expected fingerprint.
+	ErrFingerprintMismatch = errors.New("fingerprint mismatch")
+	// ErrPacketTooLarge is returned for frames above the configured size limits.
+	ErrPacketTooLarge = errors.New("message too large")
+)
+
+// CertFingerprint returns the lowercase hex SHA256 fingerprint of a certificate.
+func CertFingerprint(cert *x509.Certificate) string {
+	fp := sha256.Sum256(cert.Raw)
+	return strings.ToLower(hex.EncodeToString(fp[:]))
+}
+
+// SPKIFingerprint returns the base64 SHA256 hash of a certificate's public key (SubjectPublicKeyInfo), the pin
+// format used by HPKP and many TLS tools. Unlike CertFingerprint it stays the same when the certificate is renewed
+// with the same key.
+func SPKIFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// PeerFingerprint performs the TLS handshake if needed and returns the lowercase hex SHA256
+// fingerprint of the server's leaf certificate.
+func PeerFingerprint(conn *tls.Conn) (string, error) {
+	if err := conn.Handshake(); err != nil {
+		return "", fmt.Errorf("TLS handshake failed: %v", err)
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", fmt.Errorf("no server certificates found")
+	}
+	return CertFingerprint(certs[0]), nil
 }
 
 // VerifyFingerprint verifies the TLS certificate fingerprint against an expected value to ensure secure connection.
-// It performs a handshake, extracts the server's certificate, computes its SHA256 fingerprint, and compares it with the expected one.
-// If expectedFP is empty, it warns and allows insecure connection for development purposes.
+// It performs a handshake and checks the server's certificate with VerifyPeerCertificates.
 func VerifyFingerprint(conn *tls.Conn, expectedFP string) error {
 	if err := conn.Handshake(); err != nil {
 		return fmt.Errorf("TLS handshake failed: %v", err)
 	}
-	certs := conn.ConnectionState().PeerCertificates
+	return VerifyPeerCertificates(conn.ConnectionState().PeerCertificates, expectedFP)
+}
+
+// VerifyPeerCertificates compares the SHA256 fingerprint of the server's leaf certificate with the expected one.
+// Any of backupFPs is accepted too, for example while the server rotates its certificate.
+// If expectedFP is empty, it logs a warning and allows insecure connection for development purposes; callers that
+// own the terminal should tell the user themselves. A mismatch wraps ErrFingerprintMismatch.
+// It is suitable for tls.Config.VerifyConnection, so every transport pins the certificate the same way.
+func VerifyPeerCertificates(certs []*x509.Certificate, expectedFP string, backupFPs ...string) error {
 	if len(certs) == 0 {
 		return fmt.Errorf("no server certificates found")
 	}
-	actualFP := sha256.Sum256(certs[0].Raw)
-	actualFPHex := strings.ToLower(hex.EncodeToString(actualFP[:]))
+	actualFPHex := CertFingerprint(certs[0])
 	if expectedFP == "" {
-		fmt.Printf("\nWARNING: Connecting without certificate verification!\n")
-		fmt.Printf("Server fingerprint: %s\n", FormatFingerprint(actualFPHex))
-		fmt.Printf(
-			"For secure connections, set:\nexport CHAT_SERVER_FINGERPRINT=%s\n\n",
-			actualFPHex,
-		)
+		slog.Warn("connecting without certificate verification",
+			"fingerprint", FormatFingerprint(actualFPHex))
 		return nil
 	}
 
-	if actualFPHex == expectedFP {
-		fmt.Println("Certificate verified successfully!")
+	if actualFPHex == expectedFP || slices.Contains(backupFPs, actualFPHex) {
+		slog.Debug("certificate verified", "fingerprint", FormatFingerprint(actualFPHex))
 		return nil
 	}
 
-	fmt.Printf("Certificate fingerprint mismatch!\n")
-	fmt.Printf("Expected: %s\n", expectedFP)
-	fmt.Printf("Actual:   %s\n", actualFPHex)
-	return fmt.Errorf("fingerprint mismatch")
+	slog.Error("certificate fingerprint mismatch", "expected", expectedFP, "actual", actualFPHex)
+	return fmt.Errorf("%w: expected %s, got %s", ErrFingerprintMismatch, expectedFP, actualFPHex)
 }
 
 // FormatFingerprint formats a hexadecimal fingerprint string into a colon-separated format for better readability.
@@ -83,10 +134,10 @@ func EncodeMessage(msg Message, config *config.Config) ([]byte, error) {
 		return nil, fmt.Errorf("failed to encode message: %v", err)
 	}
 	if len(jsonData) > math.MaxUint32 {
-		return nil, fmt.Errorf("message too large: %d bytes", len(jsonData))
+		return nil, fmt.Errorf("%w: %d bytes", ErrPacketTooLarge, len(jsonData))
 	}
 	if uint32(len(jsonData)) > config.MaxPacketSize {
-		return nil, fmt.Errorf("message too large: %d bytes", len(jsonData))
+		return nil, fmt.Errorf("%w: %d bytes", ErrPacketTooLarge, len(jsonData))
 	}
 	buf := make([]byte, 4+len(jsonData))
 	binary.BigEndian.PutUint32(buf[:4], uint32(len(jsonData)))
@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReplayGuard(t *testing.T) {
+	tests := []struct {
+		name    string
+		frames  []Message
+		wantErr []error
+	}{
+		{
+			name: "monotonic sequence",
+			frames: []Message{
+				{Type: "chat", Nonce: "n", Seq: 1},
+				{Type: "chat", Nonce: "n", Seq: 2},
+				{Type: "chat", Nonce: "n", Seq: 3},
+			},
+			wantErr: []error{nil, nil, nil},
+		},
+		{
+			name: "duplicate frame",
+			frames: []Message{
+				{Type: "chat", Nonce: "n", Seq: 1},
+				{Type: "chat", Nonce: "n", Seq: 1},
+			},
+			wantErr: []error{nil, ErrDuplicateFrame},
+		},
+		{
+			name: "reordered within window",
+			frames: []Message{
+				{Type: "chat", Nonce: "n", Seq: 2},
+				{Type: "chat", Nonce: "n", Seq: 1},
+				{Type: "chat", Nonce: "n", Seq: 1},
+			},
+			wantErr: []error{nil, nil, ErrDuplicateFrame},
+		},
+		{
+			name: "frame older than window",
+			frames: []Message{
+				{Type: "chat", Nonce: "n", Seq: 1},
+				{Type: "chat", Nonce: "n", Seq: 10},
+				{Type: "chat", Nonce: "n", Seq: 2},
+			},
+			wantErr: []error{nil, nil, ErrFrameOutOfWindow},
+		},
+		{
+			name: "stale auth result from another session",
+			frames: []Message{
+				{Type: "auth_result", Nonce: "old", Seq: 1, Success: true},
+			},
+			wantErr: []error{ErrNonceMismatch},
+		},
+		{
+			name: "missing sequence number",
+			frames: []Message{
+				{Type: "chat", Nonce: "n"},
+			},
+			wantErr: []error{ErrFrameOutOfWindow},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := NewReplayGuard("n", 4)
+			for i, frame := range tt.frames {
+				err := guard.Check(frame)
+				if !errors.Is(err, tt.wantErr[i]) {
+					t.Fatalf("frame %d: Check() = %v, want %v", i, err, tt.wantErr[i])
+				}
+				var replayErr *ReplayError
+				if err != nil && !errors.As(err, &replayErr) {
+					t.Fatalf("frame %d: error %T is not *ReplayError", i, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Package transcript implements a per-sender hash chain over chat messages so
+// the client can detect a relay that silently drops or reorders messages.
+package transcript
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"silent_chat/pkg/protocol"
+)
+
+// maxKnown bounds the number of observed hashes a Chain remembers. Older
+// hashes are forgotten first, so a long session does not grow without
+// limit; links to a forgotten message are reported as missing.
+const maxKnown = 1024
+
+// Chain tracks the latest message hash of every sender seen, together with a
+// sliding window of the most recently observed hashes. A client keeps one
+// Chain across reconnects, so that its own messages stay linked for the
+// other participants. It is safe for concurrent use.
+type Chain struct {
+	mu       sync.Mutex
+	self     string
+	ownHead  string
+	lastSeen string
+	heads    map[string]string
+	known    map[string]string
+	order    []string
+}
+
+// NewChain creates an empty Chain for the local user with the given name.
+func NewChain(self string) *Chain {
+	return &Chain{
+		self:  self,
+		heads: make(map[string]string),
+		known: make(map[string]string),
+	}
+}
+
+// Hash computes the chain hash of a message from its ID, sender, text, expiry
+// and chain links. The result is a lowercase hex encoded SHA256 digest.
+func Hash(msg protocol.Message) string {
+	canonical, _ := json.Marshal(struct {
+		ID        string `json:"id"`
+		Sender    string `json:"sender"`
+		Text      string `json:"text"`
+		PrevHash  string `json:"prev"`
+		SeenHash  string `json:"seen"`
+		ExpiresAt int64  `json:"expires_at"`
+	}{msg.ID, msg.SenderName, msg.Text, msg.PrevHash, msg.SeenHash, msg.ExpiresAt})
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// Stamp links an outgoing message into our own chain. It sets PrevHash to the
+// hash of our previous message and SeenHash to the latest message we have
+// observed. The chain is not changed until the message is passed to Commit,
+// so a message that is never sent leaves no gap.
+func (c *Chain) Stamp(msg *protocol.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	msg.PrevHash = c.ownHead
+	msg.SeenHash = c.lastSeen
+}
+
+// Commit records a stamped message as our head once it has been sent.
+func (c *Chain) Commit(msg protocol.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h := Hash(msg)
+	c.ownHead = h
+	c.lastSeen = h
+	c.remember(h, c.self)
+}
+
+// Verify checks an incoming message against the chain and records it.
+// It returns human readable warnings when a message from the sender is
+// missing, when the sender's chain forks, or when the sender has seen a
+// message that never reached us. An empty result means the chain is intact.
+func (c *Chain) Verify(msg protocol.Message) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sender := msg.SenderName
+	h := Hash(msg)
+	if _, dup := c.known[h]; dup {
+		return []string{fmt.Sprintf("duplicate message from %s", sender)}
+	}
+
+	var warnings []string
+	head, seenBefore := c.heads[sender]
+	if seenBefore && msg.PrevHash != head {
+		if owner, ok := c.known[msg.PrevHash]; ok && owner == sender {
+			warnings = append(warnings,
+				fmt.Sprintf("fork detected in messages from %s", sender))
+		} else {
+			warnings = append(warnings,
+				fmt.Sprintf("missing message from %s", sender))
+		}
+	}
+	if seenBefore && msg.SeenHash != "" && msg.SeenHash != msg.PrevHash {
+		if _, ok := c.known[msg.SeenHash]; !ok {
+			warnings = append(warnings,
+				fmt.Sprintf("%s has seen a message that was not delivered to you", sender))
+		}
+	}
+
+	c.heads[sender] = h
+	c.remember(h, sender)
+	c.lastSeen = h
+
+	return warnings
+}
+
+// remember records hash h as sent by sender, forgetting the oldest hash once
+// more than maxKnown are known. The caller must hold c.mu.
+func (c *Chain) remember(h, sender string) {
+	if _, ok := c.known[h]; !ok {
+		c.order = append(c.order, h)
+	}
+	c.known[h] = sender
+	if len(c.order) > maxKnown {
+		delete(c.known, c.order[0])
+		c.order = c.order[1:]
+	}
+}
@@ -0,0 +1,160 @@
+package transcript
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"silent_chat/pkg/protocol"
+)
+
+func chatFrom(sender, id, text string) protocol.Message {
+	return protocol.Message{Type: "chat", ID: id, SenderName: sender, Text: text}
+}
+
+func TestChainVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		deliver []int
+		want    []string
+	}{
+		{
+			name:    "in order",
+			deliver: []int{0, 1, 2},
+			want:    nil,
+		},
+		{
+			name:    "dropped message",
+			deliver: []int{0, 2},
+			want:    []string{"missing message from bob"},
+		},
+		{
+			name:    "reordered messages",
+			deliver: []int{0, 2, 1},
+			want: []string{
+				"missing message from bob",
+				"fork detected in messages from bob",
+			},
+		},
+		{
+			name:    "replayed message",
+			deliver: []int{0, 1, 1},
+			want:    []string{"duplicate message from bob"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := NewChain("bob")
+			var sent []protocol.Message
+			for i, text := range []string{"one", "two", "three"} {
+				msg := chatFrom("bob", string(rune('a'+i)), text)
+				sender.Stamp(&msg)
+				sender.Commit(msg)
+				sent = append(sent, msg)
+			}
+
+			receiver := NewChain("alice")
+			var got []string
+			for _, idx := range tt.deliver {
+				got = append(got, receiver.Verify(sent[idx])...)
+			}
+
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Verify() warnings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainSeenHash(t *testing.T) {
+	alice := NewChain("alice")
+	bob := NewChain("bob")
+	carol := NewChain("carol")
+
+	first := chatFrom("bob", "1", "hello")
+	bob.Stamp(&first)
+	bob.Commit(first)
+	carol.Verify(first)
+	alice.Verify(first)
+
+	lost := chatFrom("bob", "2", "lost to alice")
+	bob.Stamp(&lost)
+	bob.Commit(lost)
+	carol.Verify(lost)
+
+	reply := chatFrom("carol", "3", "reply")
+	carol.Stamp(&reply)
+	carol.Commit(reply)
+	if warnings := alice.Verify(reply); len(warnings) != 0 {
+		t.Fatalf("first message from carol should be accepted, got %q", warnings)
+	}
+
+	next := chatFrom("carol", "4", "again")
+	carol.Stamp(&next)
+	carol.Commit(next)
+	if warnings := alice.Verify(next); len(warnings) != 0 {
+		t.Fatalf("unexpected warnings: %q", warnings)
+	}
+
+	fromBob := chatFrom("bob", "5", "still here")
+	bob.Stamp(&fromBob)
+	bob.Commit(fromBob)
+	warnings := alice.Verify(fromBob)
+	if len(warnings) == 0 || warnings[0] != "missing message from bob" {
+		t.Errorf("expected missing message warning, got %q", warnings)
+	}
+}
+
+func TestChainUnsentMessageLeavesNoGap(t *testing.T) {
+	sender := NewChain("bob")
+	receiver := NewChain("alice")
+
+	first := chatFrom("bob", "1", "hello")
+	sender.Stamp(&first)
+	sender.Commit(first)
+	receiver.Verify(first)
+
+	// The write of this message fails, so it is never committed.
+	failed := chatFrom("bob", "2", "lost in the write")
+	sender.Stamp(&failed)
+
+	next := chatFrom("bob", "3", "again")
+	sender.Stamp(&next)
+	sender.Commit(next)
+	if warnings := receiver.Verify(next); len(warnings) != 0 {
+		t.Errorf("Verify() warnings = %q, want none", warnings)
+	}
+}
+
+func TestHashChangesWithLinks(t *testing.T) {
+	msg := chatFrom("bob", "1", "hello")
+	base := Hash(msg)
+	msg.PrevHash = "00"
+	if Hash(msg) == base {
+		t.Error("Hash() must cover PrevHash")
+	}
+}
+
+func TestChainForgetsOldHashes(t *testing.T) {
+	sender := NewChain("bob")
+	receiver := NewChain("alice")
+	var first protocol.Message
+	for i := 0; i < maxKnown+10; i++ {
+		msg := chatFrom("bob", fmt.Sprint(i), "text")
+		sender.Stamp(&msg)
+		sender.Commit(msg)
+		if i == 0 {
+			first = msg
+		}
+		if warnings := receiver.Verify(msg); len(warnings) > 0 {
+			t.Fatalf("Verify(%d) warnings = %q", i, warnings)
+		}
+	}
+	if len(receiver.known) != maxKnown || len(receiver.order) != maxKnown {
+		t.Errorf("known %d hashes (order %d), want %d", len(receiver.known), len(receiver.order), maxKnown)
+	}
+	if _, ok := receiver.known[Hash(first)]; ok {
+		t.Error("oldest hash is still known")
+	}
+}
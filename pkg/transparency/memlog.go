@@ -0,0 +1,161 @@
+package transparency
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+)
+
+// MemoryLog is an in-memory append-only Merkle log. It produces the same
+// heads and proofs as the server and is used to exercise the verifier locally.
+type MemoryLog struct {
+	mu      sync.Mutex
+	leaves  [][]byte
+	entries []KeyEntry
+	index   map[string]uint64
+}
+
+// NewMemoryLog creates an empty MemoryLog.
+func NewMemoryLog() *MemoryLog {
+	return &MemoryLog{index: make(map[string]uint64)}
+}
+
+// Append adds an entry to the log and returns its leaf index.
+func (l *MemoryLog) Append(entry KeyEntry) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	idx := uint64(len(l.leaves))
+	l.leaves = append(l.leaves, LeafHash(entry.Leaf()))
+	l.entries = append(l.entries, entry)
+	l.index[entry.Username] = idx
+	return idx
+}
+
+// Head returns the current tree head.
+func (l *MemoryLog) Head() TreeHead {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return TreeHead{Size: uint64(len(l.leaves)), RootHash: rootHash(l.leaves)}
+}
+
+// InclusionProof returns the audit path for the leaf at index in the tree of the given size.
+func (l *MemoryLog) InclusionProof(index, size uint64) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if size > uint64(len(l.leaves)) || index >= size {
+		return nil, fmt.Errorf("index %d, size %d out of range", index, size)
+	}
+	return auditPath(index, l.leaves[:size]), nil
+}
+
+// ConsistencyProof returns the proof that the tree of size2 extends the tree of size1.
+func (l *MemoryLog) ConsistencyProof(size1, size2 uint64) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if size1 > size2 || size2 > uint64(len(l.leaves)) {
+		return nil, fmt.Errorf("sizes %d, %d out of range", size1, size2)
+	}
+	if size1 == 0 || size1 == size2 {
+		return nil, nil
+	}
+	return subProof(size1, l.leaves[:size2], true), nil
+}
+
+// Lookup builds a Lookup for the user's latest entry, with a consistency proof from the given trusted head.
+func (l *MemoryLog) Lookup(username string, trusted TreeHead) (Lookup, error) {
+	l.mu.Lock()
+	idx, ok := l.index[username]
+	l.mu.Unlock()
+	if !ok {
+		return Lookup{}, fmt.Errorf("no key for %q", username)
+	}
+	return l.lookupAt(idx, trusted)
+}
+
+// lookupAt builds a Lookup for the entry at idx, whether or not it is the
+// latest one of its user.
+func (l *MemoryLog) lookupAt(idx uint64, trusted TreeHead) (Lookup, error) {
+	head := l.Head()
+	inclusion, err := l.InclusionProof(idx, head.Size)
+	if err != nil {
+		return Lookup{}, err
+	}
+	consistency, err := l.ConsistencyProof(trusted.Size, head.Size)
+	if err != nil {
+		return Lookup{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Lookup{
+		Entry:            l.entries[idx],
+		LeafIndex:        idx,
+		Head:             head,
+		InclusionProof:   inclusion,
+		ConsistencyProof: consistency,
+		Frontier:         frontier(l.leaves[:idx]),
+		Later:            append([]KeyEntry(nil), l.entries[idx+1:head.Size]...),
+	}, nil
+}
+
+// frontier returns the roots of the complete subtrees covering leaves, from
+// left to right, as expected by VerifyRange.
+func frontier(leaves [][]byte) [][]byte {
+	var roots [][]byte
+	lo := uint64(0)
+	for bit := uint64(1) << 63; bit > 0; bit >>= 1 {
+		if uint64(len(leaves))&bit != 0 {
+			roots = append(roots, rootHash(leaves[lo:lo+bit]))
+			lo += bit
+		}
+	}
+	return roots
+}
+
+// largestPowerOfTwoBelow returns the largest power of two strictly less than n (n > 1).
+func largestPowerOfTwoBelow(n uint64) uint64 {
+	k := uint64(1)
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func rootHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return leaves[0]
+	}
+	k := largestPowerOfTwoBelow(uint64(len(leaves)))
+	return nodeHash(rootHash(leaves[:k]), rootHash(leaves[k:]))
+}
+
+func auditPath(m uint64, leaves [][]byte) [][]byte {
+	n := uint64(len(leaves))
+	if n <= 1 {
+		return nil
+	}
+	k := largestPowerOfTwoBelow(n)
+	if m < k {
+		return append(auditPath(m, leaves[:k]), rootHash(leaves[k:]))
+	}
+	return append(auditPath(m-k, leaves[k:]), rootHash(leaves[:k]))
+}
+
+func subProof(m uint64, leaves [][]byte, complete bool) [][]byte {
+	n := uint64(len(leaves))
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{rootHash(leaves)}
+	}
+	k := largestPowerOfTwoBelow(n)
+	if m <= k {
+		return append(subProof(m, leaves[:k], complete), rootHash(leaves[k:]))
+	}
+	return append(subProof(m-k, leaves[k:], false), rootHash(leaves[:k]))
+}
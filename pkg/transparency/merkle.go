@@ -0,0 +1,207 @@
+// Package transparency verifies identity keys published by the server through
+// an append-only Merkle log (RFC 9162 style). The client checks inclusion
+// proofs when fetching a peer's key and consistency proofs between log heads,
+// so a server that rewrites history or serves different keys to different
+// users is detected. A range proof over the end of the log shows that the key
+// is the user's latest one, so a revoked key cannot be served either; see
+// Lookup for why that proof does not scale to a large directory.
+//
+// The package is a library only: the chat protocol has no key lookup message
+// yet, so the client does not call it.
+package transparency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+var (
+	// ErrInclusionProof is returned when an inclusion proof does not match the tree head.
+	ErrInclusionProof = errors.New("invalid inclusion proof")
+	// ErrConsistencyProof is returned when two tree heads are not consistent.
+	ErrConsistencyProof = errors.New("invalid consistency proof")
+	// ErrRangeProof is returned when the leaves at the end of a tree do not match its head.
+	ErrRangeProof = errors.New("invalid range proof")
+)
+
+// LeafHash returns the Merkle leaf hash of the given data.
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// nodeHash returns the hash of an interior node with the given children.
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// VerifyInclusion checks that leafHash is the leaf at index in a tree of the
+// given size whose root is root, using the audit path in proof.
+func VerifyInclusion(index, size uint64, leafHash []byte, proof [][]byte, root []byte) error {
+	if index >= size {
+		return fmt.Errorf("%w: index %d out of range for size %d", ErrInclusionProof, index, size)
+	}
+
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return fmt.Errorf("%w: proof too long", ErrInclusionProof)
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return fmt.Errorf("%w: proof too short", ErrInclusionProof)
+	}
+	if !bytes.Equal(r, root) {
+		return fmt.Errorf("%w: root mismatch", ErrInclusionProof)
+	}
+	return nil
+}
+
+// VerifyConsistency checks that the tree of size2 with root2 is an append-only
+// extension of the tree of size1 with root1.
+func VerifyConsistency(size1, size2 uint64, proof [][]byte, root1, root2 []byte) error {
+	switch {
+	case size1 > size2:
+		return fmt.Errorf("%w: tree shrank from %d to %d", ErrConsistencyProof, size1, size2)
+	case size1 == size2:
+		if len(proof) != 0 || !bytes.Equal(root1, root2) {
+			return fmt.Errorf("%w: different roots for size %d", ErrConsistencyProof, size1)
+		}
+		return nil
+	case size1 == 0:
+		if len(proof) != 0 {
+			return fmt.Errorf("%w: non-empty proof from empty tree", ErrConsistencyProof)
+		}
+		return nil
+	case len(proof) == 0:
+		return fmt.Errorf("%w: empty proof", ErrConsistencyProof)
+	}
+
+	if size1&(size1-1) == 0 {
+		proof = append([][]byte{root1}, proof...)
+	}
+
+	fn, sn := size1-1, size2-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return fmt.Errorf("%w: proof too long", ErrConsistencyProof)
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(c, fr)
+			sr = nodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return fmt.Errorf("%w: proof too short", ErrConsistencyProof)
+	}
+	if !bytes.Equal(fr, root1) || !bytes.Equal(sr, root2) {
+		return fmt.Errorf("%w: root mismatch", ErrConsistencyProof)
+	}
+	return nil
+}
+
+// VerifyRange checks that tail holds exactly the leaf hashes from index start
+// to the end of the tree of the given size whose root is root. frontier holds
+// the roots of the complete subtrees covering the leaves before start, from
+// left to right: one subtree per set bit of start, largest first.
+func VerifyRange(start, size uint64, frontier, tail [][]byte, root []byte) error {
+	if start+uint64(len(tail)) != size {
+		return fmt.Errorf("%w: %d leaves from %d do not end a tree of size %d", ErrRangeProof, len(tail), start, size)
+	}
+	if len(tail) == 0 {
+		return fmt.Errorf("%w: empty range", ErrRangeProof)
+	}
+
+	// Index the frontier subtrees by the leaf range they cover.
+	pieces := make(map[[2]uint64][]byte, len(frontier))
+	lo := uint64(0)
+	for bit := uint64(1) << 63; bit > 0; bit >>= 1 {
+		if start&bit == 0 {
+			continue
+		}
+		if len(pieces) == len(frontier) {
+			return fmt.Errorf("%w: frontier too short", ErrRangeProof)
+		}
+		pieces[[2]uint64{lo, lo + bit}] = frontier[len(pieces)]
+		lo += bit
+	}
+	if len(pieces) != len(frontier) {
+		return fmt.Errorf("%w: frontier too long", ErrRangeProof)
+	}
+
+	// Every complete subtree left of start is a node of the tree, so the
+	// recursion reaches each frontier subtree as a whole.
+	var node func(lo, hi uint64) ([]byte, error)
+	node = func(lo, hi uint64) ([]byte, error) {
+		switch {
+		case lo >= start:
+			return rootHash(tail[lo-start : hi-start]), nil
+		case hi <= start:
+			h, ok := pieces[[2]uint64{lo, hi}]
+			if !ok {
+				return nil, fmt.Errorf("%w: no frontier subtree for leaves %d to %d", ErrRangeProof, lo, hi)
+			}
+			return h, nil
+		}
+		k := largestPowerOfTwoBelow(hi - lo)
+		left, err := node(lo, lo+k)
+		if err != nil {
+			return nil, err
+		}
+		right, err := node(lo+k, hi)
+		if err != nil {
+			return nil, err
+		}
+		return nodeHash(left, right), nil
+	}
+
+	r, err := node(0, size)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(r, root) {
+		return fmt.Errorf("%w: root mismatch", ErrRangeProof)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package transparency
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func entry(i int) KeyEntry {
+	return KeyEntry{
+		Username:  fmt.Sprintf("user%d", i),
+		PublicKey: []byte(fmt.Sprintf("key-%d", i)),
+	}
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		log := NewMemoryLog()
+		for i := 0; i < size; i++ {
+			log.Append(entry(i))
+		}
+		head := log.Head()
+
+		for i := 0; i < size; i++ {
+			proof, err := log.InclusionProof(uint64(i), head.Size)
+			if err != nil {
+				t.Fatalf("InclusionProof(%d, %d): %v", i, size, err)
+			}
+			leaf := LeafHash(entry(i).Leaf())
+			if err := VerifyInclusion(uint64(i), head.Size, leaf, proof, head.RootHash); err != nil {
+				t.Errorf("VerifyInclusion(%d, %d) = %v, want nil", i, size, err)
+			}
+
+			wrong := LeafHash(entry(i + 100).Leaf())
+			err = VerifyInclusion(uint64(i), head.Size, wrong, proof, head.RootHash)
+			if !errors.Is(err, ErrInclusionProof) {
+				t.Errorf("VerifyInclusion with wrong leaf = %v, want ErrInclusionProof", err)
+			}
+		}
+	}
+}
+
+func TestVerifyConsistency(t *testing.T) {
+	log := NewMemoryLog()
+	var heads []TreeHead
+	for i := 0; i < 20; i++ {
+		log.Append(entry(i))
+		heads = append(heads, log.Head())
+	}
+
+	for _, h1 := range heads {
+		for _, h2 := range heads {
+			if h1.Size > h2.Size {
+				continue
+			}
+			proof, err := log.ConsistencyProof(h1.Size, h2.Size)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d): %v", h1.Size, h2.Size, err)
+			}
+			if err := VerifyConsistency(h1.Size, h2.Size, proof, h1.RootHash, h2.RootHash); err != nil {
+				t.Errorf("VerifyConsistency(%d, %d) = %v, want nil", h1.Size, h2.Size, err)
+			}
+		}
+	}
+}
+
+func TestVerifyConsistencyRejectsRewrite(t *testing.T) {
+	honest := NewMemoryLog()
+	forked := NewMemoryLog()
+	for i := 0; i < 6; i++ {
+		honest.Append(entry(i))
+		if i == 2 {
+			forked.Append(KeyEntry{Username: "user2", PublicKey: []byte("attacker")})
+			continue
+		}
+		forked.Append(entry(i))
+	}
+	old := honest.Head()
+	honest.Append(entry(6))
+	forked.Append(entry(6))
+
+	proof, err := forked.ConsistencyProof(old.Size, old.Size+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyConsistency(old.Size, old.Size+1, proof, old.RootHash, forked.Head().RootHash)
+	if !errors.Is(err, ErrConsistencyProof) {
+		t.Errorf("VerifyConsistency on rewritten log = %v, want ErrConsistencyProof", err)
+	}
+}
+
+func TestVerifierLookup(t *testing.T) {
+	log := NewMemoryLog()
+	for i := 0; i < 5; i++ {
+		log.Append(entry(i))
+	}
+	v := NewVerifier(TreeHead{})
+
+	lookup, err := log.Lookup("user3", v.Head())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyLookup(lookup, "user3"); err != nil {
+		t.Fatalf("VerifyLookup() = %v, want nil", err)
+	}
+
+	for i := 5; i < 9; i++ {
+		log.Append(entry(i))
+	}
+	lookup, err = log.Lookup("user7", v.Head())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyLookup(lookup, "user7"); err != nil {
+		t.Fatalf("VerifyLookup() after growth = %v, want nil", err)
+	}
+	if v.Head().Size != 9 {
+		t.Errorf("trusted head size = %d, want 9", v.Head().Size)
+	}
+
+	if err := v.VerifyLookup(lookup, "user1"); err == nil {
+		t.Error("VerifyLookup() accepted entry for another user")
+	}
+
+	stale := TreeHead{Size: 4, RootHash: lookup.Head.RootHash}
+	if err := v.UpdateHead(stale, nil); !errors.Is(err, ErrConsistencyProof) {
+		t.Errorf("UpdateHead() with older head = %v, want ErrConsistencyProof", err)
+	}
+}
+
+func TestVerifyRange(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		var leaves [][]byte
+		for i := 0; i < size; i++ {
+			leaves = append(leaves, LeafHash(entry(i).Leaf()))
+		}
+		root := rootHash(leaves)
+		for start := 0; start < size; start++ {
+			front := frontier(leaves[:start])
+			if err := VerifyRange(uint64(start), uint64(size), front, leaves[start:], root); err != nil {
+				t.Errorf("VerifyRange(%d, %d) = %v, want nil", start, size, err)
+			}
+			if size-start > 1 {
+				short := leaves[start : size-1]
+				if err := VerifyRange(uint64(start), uint64(size-1), front, short, root); !errors.Is(err, ErrRangeProof) {
+					t.Errorf("VerifyRange(%d, %d) without the last leaf = %v, want ErrRangeProof", start, size, err)
+				}
+			}
+			swapped := append([][]byte{LeafHash([]byte("other"))}, leaves[start+1:]...)
+			if err := VerifyRange(uint64(start), uint64(size), front, swapped, root); !errors.Is(err, ErrRangeProof) {
+				t.Errorf("VerifyRange(%d, %d) with a replaced leaf = %v, want ErrRangeProof", start, size, err)
+			}
+		}
+	}
+}
+
+func TestVerifierRejectsStaleKey(t *testing.T) {
+	log := NewMemoryLog()
+	old := log.Append(KeyEntry{Username: "alice", PublicKey: []byte("old")})
+	log.Append(entry(1))
+	log.Append(KeyEntry{Username: "alice", PublicKey: []byte("new")})
+	log.Append(entry(2))
+
+	v := NewVerifier(TreeHead{})
+	stale, err := log.lookupAt(old, v.Head())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyLookup(stale, "alice"); !errors.Is(err, ErrStaleKey) {
+		t.Errorf("VerifyLookup() of a replaced key = %v, want ErrStaleKey", err)
+	}
+
+	// Hiding the newer entry breaks the range proof.
+	hidden := stale
+	hidden.Later = []KeyEntry{entry(1), entry(2)}
+	if err := v.VerifyLookup(hidden, "alice"); !errors.Is(err, ErrRangeProof) {
+		t.Errorf("VerifyLookup() with a hidden entry = %v, want ErrRangeProof", err)
+	}
+
+	latest, err := log.Lookup("alice", v.Head())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyLookup(latest, "alice"); err != nil {
+		t.Errorf("VerifyLookup() of the latest key = %v, want nil", err)
+	}
+	if string(latest.Entry.PublicKey) != "new" {
+		t.Errorf("Lookup() returned key %q, want %q", latest.Entry.PublicKey, "new")
+	}
+}
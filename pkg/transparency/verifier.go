@@ -0,0 +1,125 @@
+package transparency
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrStaleKey is returned by VerifyLookup when the log holds a newer key for
+// the user than the one returned.
+var ErrStaleKey = errors.New("key has been replaced")
+
+// TreeHead identifies a state of the key log by its size and root hash.
+type TreeHead struct {
+	Size     uint64 `json:"size"`
+	RootHash []byte `json:"root_hash"`
+}
+
+// KeyEntry is a single record in the key log binding a username to an identity public key.
+type KeyEntry struct {
+	Username  string `json:"username"`
+	PublicKey []byte `json:"public_key"`
+}
+
+// Leaf returns the canonical leaf encoding of the entry as stored in the log.
+func (e KeyEntry) Leaf() []byte {
+	data, _ := json.Marshal(e)
+	return data
+}
+
+// Lookup is the server's answer to a key request. It contains the entry, the
+// head it is proven against, the audit path for the entry and a consistency
+// proof from the verifier's last trusted head to Head. Later lists every
+// entry appended after the returned one, and Frontier the subtree roots
+// before it, so the verifier can check with VerifyRange that the user has no
+// newer key.
+//
+// This proof of freshness is a demonstration for small logs only. Later
+// grows linearly with the number of entries appended after the user's key,
+// and it discloses the usernames and keys of all of them to the client. A
+// deployment needs a per-user index, such as a prefix tree keyed by
+// username, or a signed statement of each user's latest index checked
+// against the tree head.
+type Lookup struct {
+	Entry            KeyEntry   `json:"entry"`
+	LeafIndex        uint64     `json:"leaf_index"`
+	Head             TreeHead   `json:"head"`
+	InclusionProof   [][]byte   `json:"inclusion_proof"`
+	ConsistencyProof [][]byte   `json:"consistency_proof"`
+	Frontier         [][]byte   `json:"frontier"`
+	Later            []KeyEntry `json:"later"`
+}
+
+// Verifier keeps the latest trusted tree head and checks every new head and
+// key lookup against it. It is safe for concurrent use.
+type Verifier struct {
+	mu   sync.Mutex
+	head TreeHead
+}
+
+// NewVerifier creates a Verifier that trusts the given head. A zero TreeHead
+// means no head has been seen yet and the first head is trusted on first use.
+func NewVerifier(trusted TreeHead) *Verifier {
+	return &Verifier{head: trusted}
+}
+
+// Head returns the latest trusted tree head.
+func (v *Verifier) Head() TreeHead {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.head
+}
+
+// UpdateHead checks that next is consistent with the trusted head and, if so,
+// makes it the new trusted head. Heads older than the trusted one are rejected.
+func (v *Verifier) UpdateHead(next TreeHead, proof [][]byte) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.updateHeadLocked(next, proof)
+}
+
+func (v *Verifier) updateHeadLocked(next TreeHead, proof [][]byte) error {
+	if v.head.Size == 0 {
+		v.head = next
+		return nil
+	}
+	if err := VerifyConsistency(v.head.Size, next.Size, proof, v.head.RootHash, next.RootHash); err != nil {
+		return err
+	}
+	v.head = next
+	return nil
+}
+
+// VerifyLookup checks a key lookup: the lookup head must be consistent with the
+// trusted head, the entry must be included in the log at that head, and no
+// later entry may replace it. On success the lookup head becomes the trusted
+// head.
+func (v *Verifier) VerifyLookup(l Lookup, username string) error {
+	if l.Entry.Username != username {
+		return fmt.Errorf("lookup returned key for %q, requested %q", l.Entry.Username, username)
+	}
+
+	tail := make([][]byte, 0, 1+len(l.Later))
+	tail = append(tail, LeafHash(l.Entry.Leaf()))
+	for _, e := range l.Later {
+		tail = append(tail, LeafHash(e.Leaf()))
+	}
+	if err := VerifyRange(l.LeafIndex, l.Head.Size, l.Frontier, tail, l.Head.RootHash); err != nil {
+		return err
+	}
+	for i, e := range l.Later {
+		if e.Username == username {
+			return fmt.Errorf("%w: %q has a newer key at index %d", ErrStaleKey, username, l.LeafIndex+1+uint64(i))
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := VerifyInclusion(l.LeafIndex, l.Head.Size, LeafHash(l.Entry.Leaf()), l.InclusionProof, l.Head.RootHash); err != nil {
+		return err
+	}
+	return v.updateHeadLocked(l.Head, l.ConsistencyProof)
+}
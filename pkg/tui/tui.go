@@ -0,0 +1,913 @@
+// Package tui is the Bubble Tea front end of silent_chat. It collects
+// credentials with ui.AuthModel, connects through the headless client
+// package and renders the session with ui.ChatModel.
+//
+// The chat program is started once and survives reconnects: a supervisor
+// goroutine redials in the background, shows a banner in the chat view while
+// offline and asks the server for the messages missed in the meantime.
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"silent_chat/internal/utils"
+	"silent_chat/pkg/client"
+	"silent_chat/pkg/config"
+	"silent_chat/pkg/history"
+	"silent_chat/pkg/protocol"
+	"silent_chat/pkg/transcript"
+	"silent_chat/pkg/ui"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	clearScreen     = "\033[2J\033[H"
+	clearScrollback = "\033[3J"
+
+	// maxSeenIDs bounds the set of message IDs remembered for de-duplicating
+	// messages re-sent by the server after a reconnect.
+	maxSeenIDs = 1024
+)
+
+type Client struct {
+	Config  *config.Config
+	History *history.Store
+	// Outbox queues chat messages that could not be sent. Run creates an
+	// in-memory outbox if it is nil.
+	Outbox *client.Outbox
+	// Retry decides when to reconnect. Run uses client.NewRetryPolicy with
+	// Config if it is nil.
+	Retry client.RetryPolicy
+	// Metrics counts traffic across all sessions and backs the /stats
+	// command. Run creates one if it is nil.
+	Metrics  *client.Metrics
+	Username string
+	State    *client.Machine
+
+	mutex   sync.Mutex
+	session *client.Session
+	program *tea.Program
+	// creds holds the login of the last successful session, including its
+	// resume token, so reconnects do not show the login form again.
+	creds *client.Options
+	// loginErr is set by the supervisor when the cached credentials are
+	// rejected and the user has to log in again.
+	loginErr error
+	// rejected keeps the host, port and username of credentials the server
+	// rejected, so the login form can be pre-filled.
+	rejected *client.Options
+	// fatalErr is set by the supervisor for errors that reconnecting cannot
+	// fix, such as a server certificate mismatch. Run returns it.
+	fatalErr error
+
+	// warnedFP is the unverified fingerprint the user was last warned about.
+	warnedFP string
+
+	retryNow chan struct{}
+	giveUp   chan struct{}
+
+	seenIDs   map[string]struct{}
+	seenOrder []string
+	// lastID is the last chat message received from the server. It is
+	// never one of our own messages, which the server may not have yet.
+	lastID string
+}
+
+// Close closes the current session, if any.
+func (c *Client) Close() error {
+	session := c.currentSession()
+	if session == nil {
+		return nil
+	}
+	return session.Close()
+}
+
+func (c *Client) currentSession() *client.Session {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.session
+}
+
+// errCancelled is returned by login when the user closes the login form.
+var errCancelled = errors.New("cancelled by user")
+
+// Connect establishes a session with the cached credentials. It first tries
+// the resume token and falls back to the cached password. If the password is
+// rejected too, the credentials are dropped so the next login shows the form.
+func (c *Client) Connect(ctx context.Context) error {
+	c.mutex.Lock()
+	opts := c.creds
+	c.mutex.Unlock()
+	if opts == nil {
+		return fmt.Errorf("not logged in")
+	}
+
+	session, err := client.Dial(ctx, *opts)
+	if errors.Is(err, client.ErrResumeRejected) {
+		fallback := *opts
+		fallback.ResumeToken = ""
+		session, err = client.Dial(ctx, fallback)
+	}
+	if err != nil {
+		if errors.Is(err, client.ErrAuthFailed) {
+			c.mutex.Lock()
+			c.rejected = &client.Options{Host: opts.Host, Port: opts.Port, Username: opts.Username}
+			c.creds = nil
+			c.mutex.Unlock()
+		}
+		return err
+	}
+
+	cached := *opts
+	cached.ResumeToken = session.ResumeToken()
+
+	c.mutex.Lock()
+	c.creds = &cached
+	c.session = session
+	c.Username = session.Username()
+	c.mutex.Unlock()
+	return nil
+}
+
+// login shows the login form, pre-filled from the previous login if there was
+// one, and caches the entered credentials for Connect.
+func (c *Client) login(ctx context.Context, prev *client.Options, loginErr error) error {
+	model := ui.NewAuthModel()
+	if prev != nil {
+		model = model.WithValues(prev.Host, prev.Port, prev.Username)
+	}
+	if loginErr != nil {
+		model = model.WithError(loginErr)
+	}
+
+	fmt.Print(clearScreen)
+	p := tea.NewProgram(model, tea.WithContext(ctx))
+	result, err := p.Run()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("auth UI error: %v", err)
+	}
+
+	authModel, ok := result.(ui.AuthModel)
+	if !ok {
+		return fmt.Errorf("unexpected model type")
+	}
+
+	authData, err := authModel.GetAuthData()
+	if err != nil {
+		return errCancelled
+	}
+
+	// The server entered in the form is the primary endpoint; the
+	// configured fallbacks default to its port.
+	fallbacks, err := client.ParseEndpoints(strings.Join(c.Config.Endpoints, ","), authData.Port)
+	if err != nil {
+		return fmt.Errorf("fallback endpoints: %w", err)
+	}
+	endpoints := append([]client.Endpoint{{Host: authData.Host, Port: authData.Port}}, fallbacks...)
+
+	c.mutex.Lock()
+	c.creds = &client.Options{
+		Host:      authData.Host,
+		Port:      authData.Port,
+		Endpoints: endpoints,
+		Username:  authData.Username,
+		Password:  authData.Password,
+		Config:    c.Config,
+		Machine:   c.State,
+		Metrics:   c.Metrics,
+		// One chain for all sessions of this login keeps our messages
+		// linked across reconnects.
+		Transcript: transcript.NewChain(authData.Username),
+	}
+	c.Username = authData.Username
+	c.mutex.Unlock()
+	return nil
+}
+
+// supervise keeps the client connected while the chat program runs. It
+// reports progress in the chat banner, forwards session events and, after a
+// reconnect, requests the messages missed while offline. Reconnect delays
+// come from Retry; while waiting, the user can retry at once or give up. If
+// the credentials are rejected it records the reason in loginErr and quits
+// the program after Config.AuthFailDelay; on any other error that retrying
+// cannot fix it records fatalErr instead.
+func (c *Client) supervise(ctx context.Context, p *tea.Program) {
+	attempt := 0
+
+	for ctx.Err() == nil {
+		p.Send(ui.ConnectionStatusMsg{Text: "Connecting..."})
+
+		failure := "Connection failed"
+		err := c.Connect(ctx)
+		if err == nil {
+			attempt = 0
+			session := c.currentSession()
+			p.Send(ui.ConnectionStatusMsg{})
+			p.Send(ui.EndpointMsg{Addr: session.Addr(), Fallback: session.Fallback()})
+			c.warnUnverified(session, p)
+			// Queued messages go out first, so that the messages the
+			// server re-sends cannot get ahead of them.
+			for _, id := range c.flushOutbox(ctx) {
+				p.Send(ui.MessageSentMsg{ID: id})
+			}
+			c.requestMissed(ctx, session)
+
+			var recovered atomic.Bool
+			watchCtx, stopWatching := context.WithCancel(ctx)
+			if session.Fallback() {
+				go c.watchPrimary(watchCtx, session, &recovered)
+			}
+			err = c.Listen(ctx, session, p)
+			stopWatching()
+			if recovered.Load() && ctx.Err() == nil {
+				p.Send(ui.SystemMsg{Text: "The primary server is reachable again. Switching back."})
+				continue
+			}
+			if err == nil {
+				err = errConnectionClosed
+			}
+			failure = "Connection lost"
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if errors.Is(err, client.ErrAuthFailed) {
+			c.mutex.Lock()
+			c.loginErr = err
+			c.mutex.Unlock()
+			// Slow down password guessing before the login form returns.
+			if delay := c.Config.AuthFailDelay; delay > 0 {
+				p.Send(ui.ConnectionStatusMsg{
+					Text: fmt.Sprintf("Authentication failed. Login again in %v...", delay),
+				})
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
+			p.Quit()
+			return
+		}
+		if !client.Retryable(err) {
+			c.mutex.Lock()
+			c.fatalErr = err
+			c.mutex.Unlock()
+			p.Quit()
+			return
+		}
+
+		attempt++
+		delay, ok := c.Retry.Next(attempt, err)
+		if ok {
+			p.Send(ui.ConnectionStatusMsg{
+				Text: fmt.Sprintf("%s: %v. Reconnecting in %v (attempt %d)...",
+					failure, err, delay.Round(100*time.Millisecond), attempt),
+				CanRetry:  true,
+				CanGiveUp: true,
+			})
+			switch c.backoff(ctx, delay) {
+			case waitCancelled:
+				return
+			case waitElapsed, waitRetryNow:
+				continue
+			}
+		}
+
+		p.Send(ui.ConnectionStatusMsg{
+			Text:     fmt.Sprintf("Offline after %d failed attempt(s): %v.", attempt, err),
+			CanRetry: true,
+		})
+		if c.backoff(ctx, -1) == waitCancelled {
+			return
+		}
+		attempt = 0
+	}
+}
+
+// watchPrimary probes the primary endpoint every
+// Config.PrimaryProbeInterval while session is connected to a fallback. Once
+// the primary answers with the pinned certificate, it sets recovered and ends
+// the session gracefully; the supervisor then reconnects, which prefers the
+// primary again.
+func (c *Client) watchPrimary(ctx context.Context, session *client.Session, recovered *atomic.Bool) {
+	c.mutex.Lock()
+	opts := c.creds
+	c.mutex.Unlock()
+	if opts == nil || len(opts.Endpoints) == 0 || c.Config.PrimaryProbeInterval <= 0 {
+		return
+	}
+	primary := opts.Endpoints[0]
+
+	ticker := time.NewTicker(c.Config.PrimaryProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-session.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := client.Probe(ctx, *opts, primary)
+		if errors.Is(err, client.ErrFingerprintMismatch) {
+			slog.Warn("primary endpoint presents an unexpected certificate", "addr", primary, "err", err)
+			continue
+		}
+		if err != nil {
+			slog.Debug("primary endpoint still unavailable", "addr", primary, "err", err)
+			continue
+		}
+
+		slog.Info("primary endpoint recovered", "addr", primary, "fallback", session.Addr())
+		recovered.Store(true)
+		c.shutdown()
+		return
+	}
+}
+
+// warnUnverified tells the user, once per server certificate, that the
+// connection is not pinned to a fingerprint.
+func (c *Client) warnUnverified(session *client.Session, p *tea.Program) {
+	fp := session.Fingerprint()
+	if c.Config.ExpectedFP != "" || fp == c.warnedFP {
+		return
+	}
+	c.warnedFP = fp
+	p.Send(ui.SystemMsg{Text: fmt.Sprintf(
+		"Server certificate not verified (fingerprint %s). Set CHAT_SERVER_FINGERPRINT=%s to pin it.",
+		protocol.FormatFingerprint(fp), fp,
+	)})
+}
+
+// errNotConnected is reported for sends while there is no session.
+var errNotConnected = errors.New("not connected")
+
+// errConnectionClosed stands in for the cause of a session that ended
+// without an error, such as the server closing the connection.
+var errConnectionClosed = errors.New("connection closed")
+
+// requestMissed asks the server to re-send the chat messages that followed
+// the last one we received. Duplicates are filtered by message ID.
+func (c *Client) requestMissed(ctx context.Context, session *client.Session) {
+	c.mutex.Lock()
+	lastID := c.lastID
+	c.mutex.Unlock()
+	if lastID == "" {
+		return
+	}
+	if err := session.Send(ctx, protocol.Message{Type: "sync", ID: lastID}); err != nil {
+		slog.Warn("request missed messages", "err", err)
+	}
+}
+
+// flushOutbox sends the queued messages over the current session, in order,
+// and returns the IDs delivered. Delivery stops at the first failure; the
+// rest stays queued for the next reconnect.
+func (c *Client) flushOutbox(ctx context.Context) []string {
+	session := c.currentSession()
+	if session == nil || c.Outbox.Len() == 0 {
+		return nil
+	}
+	sent, err := c.Outbox.Flush(ctx, session.Send)
+	if err != nil {
+		slog.Warn("flush outbox", "pending", c.Outbox.Len(), "err", err)
+	}
+	return sent
+}
+
+// Listen forwards session events to the chat program until the session
+// closes or ctx is cancelled. It returns the reason the session closed.
+func (c *Client) Listen(ctx context.Context, session *client.Session, p *tea.Program) error {
+	for {
+		var ev client.Event
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case next, ok := <-session.Events():
+			if !ok {
+				return nil
+			}
+			ev = next
+		}
+
+		switch ev := ev.(type) {
+		case client.MessageEvent:
+			c.handleMessage(ev, p)
+		case client.ErrorEvent:
+			var replayErr *protocol.ReplayError
+			if errors.As(ev.Err, &replayErr) {
+				p.Send(ui.SystemMsg{Text: replayErr.Error()})
+			}
+		case client.StateEvent:
+			if ev.State == client.StateDisconnected {
+				return ev.Err
+			}
+		}
+	}
+}
+
+// markSeen records a message ID and reports whether it was new.
+func (c *Client) markSeen(id string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if id == "" {
+		return true
+	}
+	if c.seenIDs == nil {
+		c.seenIDs = make(map[string]struct{})
+	}
+	if _, ok := c.seenIDs[id]; ok {
+		return false
+	}
+	c.seenIDs[id] = struct{}{}
+	c.seenOrder = append(c.seenOrder, id)
+	if len(c.seenOrder) > maxSeenIDs {
+		delete(c.seenIDs, c.seenOrder[0])
+		c.seenOrder = c.seenOrder[1:]
+	}
+	return true
+}
+
+// markReceived records id as the last chat message received from the
+// server, where requestMissed resumes after a reconnect.
+func (c *Client) markReceived(id string) {
+	if id == "" {
+		return
+	}
+	c.mutex.Lock()
+	c.lastID = id
+	c.mutex.Unlock()
+}
+
+func (c *Client) handleMessage(ev client.MessageEvent, p *tea.Program) {
+	msg := ev.Message
+	switch {
+	case msg.Type == "chat" && msg.Text != "" && msg.SenderName != "":
+		if !c.markSeen(msg.ID) {
+			return
+		}
+		c.markReceived(msg.ID)
+		var expiresAt time.Time
+		if msg.ExpiresAt > 0 {
+			expiresAt = time.Unix(msg.ExpiresAt, 0)
+			if !time.Now().Before(expiresAt) {
+				return
+			}
+		}
+		c.saveHistory(msg)
+		p.Send(ui.NewChatMsg{
+			Sender:    msg.SenderName,
+			Text:      msg.Text,
+			Warnings:  ev.Warnings,
+			ExpiresAt: expiresAt,
+		})
+	case msg.Type == "timer" && msg.SenderName != "":
+		p.Send(ui.TimerMsg{
+			Sender: msg.SenderName,
+			TTL:    time.Duration(msg.TTL) * time.Second,
+		})
+	}
+}
+
+func (c *Client) saveHistory(msg protocol.Message) {
+	if c.History == nil {
+		return
+	}
+	entry := history.Entry{
+		ID:        msg.ID,
+		Sender:    msg.SenderName,
+		Text:      msg.Text,
+		Time:      time.Now().Unix(),
+		ExpiresAt: msg.ExpiresAt,
+	}
+	if err := c.History.Append(entry); err != nil {
+		c.report("Could not save the message to history", err)
+	}
+}
+
+func (c *Client) historyMessages() []ui.NewChatMsg {
+	if c.History == nil {
+		return nil
+	}
+	entries := c.History.Entries()
+	msgs := make([]ui.NewChatMsg, 0, len(entries))
+	for _, e := range entries {
+		msg := ui.NewChatMsg{
+			ID:      e.ID,
+			Sender:  e.Sender,
+			Text:    e.Text,
+			Pending: e.ID != "" && c.Outbox.Contains(e.ID),
+		}
+		if e.ExpiresAt > 0 {
+			msg.ExpiresAt = time.Unix(e.ExpiresAt, 0)
+		}
+		msgs = append(msgs, msg)
+		c.markSeen(e.ID)
+		if e.Sender != c.Username {
+			c.markReceived(e.ID)
+		}
+	}
+	return msgs
+}
+
+// pendingMessages returns the queued messages that are not part of the
+// history, for example because history is disabled.
+func (c *Client) pendingMessages() []ui.NewChatMsg {
+	var msgs []ui.NewChatMsg
+	for _, m := range c.Outbox.Pending() {
+		if m.Type != "chat" || !c.markSeen(m.ID) {
+			continue
+		}
+		msg := ui.NewChatMsg{ID: m.ID, Sender: m.SenderName, Text: m.Text, Pending: true}
+		if m.ExpiresAt > 0 {
+			msg.ExpiresAt = time.Unix(m.ExpiresAt, 0)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// Wipe drops all in-memory session state and securely deletes the local
+// history, the outbox and every file listed in Config.WipePaths. Only then
+// does it close the connection, abruptly and without a "leave" message, so
+// no network I/O delays the deletion. It keeps going after a failure and
+// returns the first error.
+func (c *Client) Wipe() error {
+	c.mutex.Lock()
+	session := c.session
+	c.session = nil
+	c.Username = ""
+	c.creds = nil
+	c.seenIDs = nil
+	c.seenOrder = nil
+	c.lastID = ""
+	c.mutex.Unlock()
+	if session != nil {
+		defer session.Close()
+	}
+
+	var firstErr error
+	if c.History != nil {
+		firstErr = c.History.Destroy()
+		c.History = nil
+	}
+	if c.Outbox != nil {
+		if err := c.Outbox.Clear(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, path := range c.Config.WipePaths {
+		if err := utils.SecureDelete(path); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+type waitResult int
+
+const (
+	waitElapsed waitResult = iota
+	waitRetryNow
+	waitGaveUp
+	waitCancelled
+)
+
+// backoff moves the state machine to StateBackoff and waits for the given
+// delay, or until the user retries if delay is negative. The user can cut
+// the wait short with "retry now" or "give up".
+func (c *Client) backoff(ctx context.Context, delay time.Duration) waitResult {
+	if err := c.State.Transition(client.StateBackoff, nil); err != nil {
+		slog.Debug("state transition", "to", client.StateBackoff, "err", err)
+	}
+
+	// Ignore presses from before this wait started.
+	select {
+	case <-c.retryNow:
+	default:
+	}
+	select {
+	case <-c.giveUp:
+	default:
+	}
+
+	var elapsed <-chan time.Time
+	if delay >= 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		elapsed = timer.C
+	}
+
+	select {
+	case <-elapsed:
+		return waitElapsed
+	case <-c.retryNow:
+		return waitRetryNow
+	case <-c.giveUp:
+		return waitGaveUp
+	case <-ctx.Done():
+		return waitCancelled
+	}
+}
+
+// trigger delivers a user request to the supervisor without blocking.
+func trigger(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// shutdown ends the current session gracefully within Config.ShutdownTimeout.
+func (c *Client) shutdown() {
+	c.mutex.Lock()
+	session := c.session
+	c.session = nil
+	c.mutex.Unlock()
+	if session == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Config.ShutdownTimeout)
+	defer cancel()
+	if err := session.Shutdown(ctx); err != nil {
+		slog.Warn("close connection", "err", err)
+	}
+}
+
+// newChatModel builds the chat view. Sending goes through whatever session
+// is current, so the model keeps working across reconnects. The callbacks
+// run inside the program's Update and therefore never wait for the network;
+// delivery happens in the background and is reported back as tea.Msg values.
+func (c *Client) newChatModel(ctx context.Context) ui.ChatModel {
+	send := func(msg protocol.Message) {
+		session := c.currentSession()
+		if session == nil {
+			c.report("Could not send "+msg.Type+" message", errNotConnected)
+			return
+		}
+		result, err := session.SendAsync(msg)
+		if err != nil {
+			c.report("Could not send "+msg.Type+" message", err)
+			return
+		}
+		go func() {
+			if err := <-result; err != nil {
+				c.report("Could not send "+msg.Type+" message", err)
+			}
+		}()
+	}
+
+	chatModel := ui.NewChatModel(c.Username, func(text string, ttl time.Duration) (string, bool) {
+		id, err := utils.RandomString(16)
+		if err != nil {
+			c.report("Could not send the message", err)
+			return "", true
+		}
+		msgData := protocol.Message{
+			Type:       "chat",
+			ID:         id,
+			Text:       text,
+			SenderName: c.Username,
+		}
+		if ttl > 0 {
+			msgData.ExpiresAt = time.Now().Add(ttl).Unix()
+		}
+		c.markSeen(id)
+		c.saveHistory(msgData)
+
+		// Chat messages always go through the outbox so that messages
+		// queued while offline are delivered before this one.
+		if _, err := c.Outbox.Add(msgData); err != nil {
+			c.report("Could not queue the message", err)
+		}
+		go c.deliver(ctx, id)
+		return id, c.currentSession() == nil
+	}, func(ttl time.Duration) {
+		send(protocol.Message{
+			Type:       "timer",
+			SenderName: c.Username,
+			TTL:        int64(ttl / time.Second),
+		})
+	})
+
+	return chatModel.
+		WithHistory(c.historyMessages()).
+		WithHistory(c.pendingMessages()).
+		WithKnownNames(c.Config.Contacts...).
+		WithStats(c.statsLines).
+		WithReconnectControls(
+			func() { trigger(c.retryNow) },
+			func() { trigger(c.giveUp) },
+		)
+}
+
+// deliver flushes the outbox and reports the outcome for each message to the
+// chat program: delivered messages are marked as sent, and the message with
+// the given ID is marked as pending if it is still queued.
+func (c *Client) deliver(ctx context.Context, id string) {
+	for _, sent := range c.flushOutbox(ctx) {
+		c.notify(ui.MessageSentMsg{ID: sent})
+	}
+	if c.Outbox.Contains(id) {
+		c.notify(ui.MessageQueuedMsg{ID: id})
+	}
+}
+
+// statsLines formats Metrics for the /stats command.
+func (c *Client) statsLines() []string {
+	s := c.Metrics.Snapshot()
+	traffic := func(byClass map[string]client.Traffic) string {
+		parts := make([]string, 0, len(byClass))
+		for _, class := range []string{client.ClassChat, client.ClassFake, client.ClassControl} {
+			t := byClass[class]
+			parts = append(parts, fmt.Sprintf("%s %d (%s)", class, t.Frames, formatBytes(t.Bytes)))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return []string{
+		fmt.Sprintf("connections: %d established, %d reconnects, %d of %d dials failed, %d auth failures",
+			s.Connects, s.Reconnects, s.DialFailures, s.Dials, s.AuthFailures),
+		"sent: " + traffic(s.Sent),
+		"received: " + traffic(s.Received),
+		fmt.Sprintf("send queue: %d (max %d)", s.QueueDepth, s.MaxQueueDepth),
+		fmt.Sprintf("round trip: %v (avg %v)", s.LastRTT.Round(time.Millisecond), s.AvgRTT.Round(time.Millisecond)),
+	}
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// report logs a user-facing error and shows it in the chat view as a system
+// message, since printing would corrupt the screen while the TUI runs.
+func (c *Client) report(text string, err error) {
+	slog.Error(text, "err", err)
+	c.notify(ui.SystemMsg{Text: fmt.Sprintf("%s: %v", text, err)})
+}
+
+// notify delivers msg to the running chat program. It does not block, so it
+// is safe to call from the program's own callbacks.
+func (c *Client) notify(msg tea.Msg) {
+	c.mutex.Lock()
+	p := c.program
+	c.mutex.Unlock()
+	if p != nil {
+		go p.Send(msg)
+	}
+}
+
+// pruneHistory removes expired history entries every minute until stop is closed.
+func (c *Client) pruneHistory(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if c.History != nil {
+				if err := c.History.Prune(now); err != nil {
+					slog.Warn("prune history", "err", err)
+				}
+			}
+		}
+	}
+}
+
+// Run drives the login form and a single long-lived chat program until the
+// user quits or ctx is cancelled. Cancellation is a graceful shutdown and
+// returns nil. The login form is shown again only if the server rejects the
+// cached credentials; the chat history on screen is kept in that case too.
+func (c *Client) Run(ctx context.Context) error {
+	if c.State == nil {
+		c.State = client.NewMachine()
+	}
+	if c.Outbox == nil {
+		c.Outbox, _ = client.NewOutbox("", nil)
+	}
+	if c.Metrics == nil {
+		c.Metrics = client.NewMetrics()
+	}
+	if c.Retry == nil {
+		c.Retry = client.NewRetryPolicy(c.Config)
+	}
+	c.retryNow = make(chan struct{}, 1)
+	c.giveUp = make(chan struct{}, 1)
+	defer c.State.Close()
+
+	stopPrune := make(chan struct{})
+	defer close(stopPrune)
+	go c.pruneHistory(stopPrune)
+
+	var (
+		chat     *ui.ChatModel
+		prev     *client.Options
+		loginErr error
+	)
+	if c.Config.Host != "" {
+		// A profile names the server and user, so only the password is asked.
+		prev = &client.Options{Host: c.Config.Host, Port: c.Config.Port, Username: c.Config.Username}
+	}
+
+	for {
+		if err := c.login(ctx, prev, loginErr); err != nil {
+			if ctx.Err() != nil || errors.Is(err, errCancelled) {
+				return nil
+			}
+			return err
+		}
+
+		var model ui.ChatModel
+		if chat == nil {
+			model = c.newChatModel(ctx)
+		} else {
+			model = chat.WithUsername(c.Username)
+		}
+
+		p := tea.NewProgram(model, tea.WithAltScreen(), tea.WithContext(ctx))
+		c.mutex.Lock()
+		c.program = p
+		c.mutex.Unlock()
+
+		supervisorCtx, cancel := context.WithCancel(ctx)
+		supervisorDone := make(chan struct{})
+		go func() {
+			c.supervise(supervisorCtx, p)
+			close(supervisorDone)
+		}()
+
+		finalModel, err := p.Run()
+
+		final, ok := finalModel.(ui.ChatModel)
+		if ok && final.Wiped() {
+			// Delete local data first: no graceful shutdown, and no
+			// waiting for the supervisor, which may be in the network.
+			cancel()
+			wipeErr := c.Wipe()
+			<-supervisorDone
+			c.Close() // in case the supervisor connected during the wipe
+			c.mutex.Lock()
+			c.program = nil
+			c.mutex.Unlock()
+			fmt.Print(clearScrollback + clearScreen)
+			return wipeErr
+		}
+
+		cancel()
+		<-supervisorDone
+		c.shutdown()
+		c.mutex.Lock()
+		c.program = nil
+		c.mutex.Unlock()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("chat UI error: %v", err)
+		}
+		if !ok {
+			return fmt.Errorf("unexpected model type")
+		}
+
+		c.mutex.Lock()
+		loginErr, c.loginErr = c.loginErr, nil
+		prev, c.rejected = c.rejected, nil
+		fatalErr := c.fatalErr
+		c.mutex.Unlock()
+		if fatalErr != nil {
+			return fatalErr
+		}
+		if loginErr == nil {
+			fmt.Println("God loves the patient. Internet respects privacy.")
+			return nil
+		}
+
+		chat = &final
+	}
+}
@@ -13,7 +13,7 @@ const silentChatASCII = `
 // const welcomeText = “
 func GetASCIIArt() string {
 	style := lipgloss.NewStyle().
-		Foreground(Nord8).
+		Foreground(ColorPrimaryLight).
 		Bold(true).
 		Align(lipgloss.Center)
 
@@ -35,7 +35,7 @@ func GetSeparator(width int) string {
 	}
 
 	style := lipgloss.NewStyle().
-		Foreground(Nord3)
+		Foreground(ColorGrayDark)
 
 	separator := ""
 	for i := 0; i < width; i++ {
@@ -52,6 +52,30 @@ func NewAuthModel() AuthModel {
 	}
 }
 
+// WithValues returns a copy of the form pre-filled with a previous login or
+// a saved profile, with the focus on the password field.
+func (m AuthModel) WithValues(host, port, username string) AuthModel {
+	m.inputs[0].SetValue(host)
+	m.inputs[1].SetValue(port)
+	m.inputs[3].SetValue(username)
+	m.step = 2
+	for i := range m.inputs {
+		if i == m.step {
+			m.inputs[i].Focus()
+		} else {
+			m.inputs[i].Blur()
+		}
+	}
+	return m
+}
+
+// WithError returns a copy of the form showing err, for example why the
+// previous login was rejected.
+func (m AuthModel) WithError(err error) AuthModel {
+	m.err = err
+	return m
+}
+
 func (m AuthModel) Init() tea.Cmd {
 	return textinput.Blink
 }
@@ -78,11 +102,15 @@ func (m AuthModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.inputs[m.step].Focus()
 			}
 		case "enter":
-			if m.step < 3 {
+			// With the username already filled in, as for a saved profile,
+			// the password is the last thing to enter.
+			if m.step < 3 && !(m.step == 2 && m.inputs[3].Value() != "") {
 				m.step++
 				m.inputs[m.step].Focus()
 			} else {
 				h, p, pw, u := m.inputs[0].Value(), m.inputs[1].Value(), m.inputs[2].Value(), m.inputs[3].Value()
+				// Accept IPv6 literals in URL form, e.g. [2001:db8::1].
+				h = strings.TrimSuffix(strings.TrimPrefix(h, "["), "]")
 				if h == "" || p == "" || pw == "" || u == "" {
 					m.err = fmt.Errorf("all fields required")
 					return m, nil
@@ -131,7 +159,15 @@ func (m AuthModel) View() string {
 	}
 
 	if m.err != nil {
-		s.WriteString(ErrorStyle().Render("Error: "+m.err.Error()) + "\n")
+		// Login errors can carry text from the server.
+		text, _ := Sanitize(m.err.Error())
+		s.WriteString(ErrorStyle().Render("Error: "+text) + "\n")
+	}
+
+	if HasConfusableChars(m.inputs[3].Value()) {
+		s.WriteString(WarningStyle().Render(
+			"Warning: username contains characters that look like other letters",
+		) + "\n")
 	}
 
 	s.WriteString(
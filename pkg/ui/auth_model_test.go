@@ -0,0 +1,48 @@
+package ui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestAuthProfileNeedsOnlyPassword(t *testing.T) {
+	var model tea.Model = NewAuthModel().WithValues("2001:db8::1", "4000", "alice")
+
+	for _, r := range "secret" {
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	data, err := model.(AuthModel).GetAuthData()
+	if err != nil {
+		t.Fatalf("GetAuthData() error = %v", err)
+	}
+	if *data != (AuthData{Host: "2001:db8::1", Port: "4000", Password: "secret", Username: "alice"}) {
+		t.Errorf("GetAuthData() = %+v", *data)
+	}
+}
+
+func TestAuthAcceptsBracketedIPv6(t *testing.T) {
+	var model tea.Model = NewAuthModel().WithValues("[::1]", "4000", "alice")
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("pw")})
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	data, err := model.(AuthModel).GetAuthData()
+	if err != nil {
+		t.Fatalf("GetAuthData() error = %v", err)
+	}
+	if data.Host != "::1" {
+		t.Errorf("Host = %q, want %q", data.Host, "::1")
+	}
+}
+
+func TestAuthErrorIsSanitized(t *testing.T) {
+	err := errors.New("authentication failed: \x1b]0;owned\a")
+	view := NewAuthModel().WithError(err).View()
+	if strings.Contains(view, "\x1b]0;") || !strings.Contains(view, `\x1b]0;owned\x07`) {
+		t.Errorf("View() does not escape the error: %q", view)
+	}
+}
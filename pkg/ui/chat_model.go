@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
@@ -12,41 +13,172 @@ type ChatModel struct {
 	messages     []chatMsg
 	input        textinput.Model
 	username     string
-	onSend       func(string)
+	onSend       SendFunc
+	onTimer      func(time.Duration)
+	ttl          time.Duration
+	proposal     *TimerMsg
 	width        int
 	height       int
 	scrollOffset int
+	wiped        bool
+	names        nameRegistry
+	banner       string
+	endpoint     string
+	fallback     bool
+	canRetry     bool
+	canGiveUp    bool
+	onRetryNow   func()
+	onGiveUp     func()
+	stats        func() []string
 }
 
+// SendFunc delivers a message typed by the user. It returns the message ID
+// and whether the message was queued for later delivery instead of sent.
+type SendFunc func(text string, ttl time.Duration) (id string, pending bool)
+
 type chatMsg struct {
-	Sender string
-	Text   string
+	ID        string
+	Pending   bool
+	Sender    string
+	Text      string
+	System    bool
+	ExpiresAt time.Time
+	Lookalike string
 }
 
 type NewChatMsg struct {
+	ID        string
+	Sender    string
+	Text      string
+	Warnings  []string
+	ExpiresAt time.Time
+	Pending   bool
+}
+
+// MessageSentMsg reports that the message with the given ID was delivered.
+type MessageSentMsg struct {
+	ID string
+}
+
+// MessageQueuedMsg reports that the message with the given ID could not be
+// sent yet and is waiting for a connection.
+type MessageQueuedMsg struct {
+	ID string
+}
+
+// TimerMsg announces that a peer changed the disappearing message timer.
+// The sender is not authenticated, so the change only takes effect for the
+// local user after /timer accept.
+type TimerMsg struct {
 	Sender string
-	Text   string
+	TTL    time.Duration
+}
+
+// ConnectionStatusMsg sets the connection banner shown above the messages,
+// for example while reconnecting. An empty Text hides the banner. CanRetry
+// and CanGiveUp enable the "retry now" (Ctrl+R) and "give up" (Ctrl+G)
+// controls until the next status.
+type ConnectionStatusMsg struct {
+	Text      string
+	CanRetry  bool
+	CanGiveUp bool
+}
+
+// EndpointMsg shows the server address the client is connected to in the
+// title bar. Fallback marks an address other than the preferred one.
+type EndpointMsg struct {
+	Addr     string
+	Fallback bool
+}
+
+type expireTickMsg time.Time
+
+type SystemMsg struct {
+	Text string
 }
 
-func NewChatModel(username string, onSend func(string)) ChatModel {
+func NewChatModel(
+	username string,
+	onSend SendFunc,
+	onTimer func(time.Duration),
+) ChatModel {
 	ti := textinput.New()
-	ti.Placeholder = "Type a message... for exit type /quit or CTRL+C to exit"
+	ti.Placeholder = "Type a message... for exit type /quit or CTRL+C, /wipe or CTRL+X to wipe"
 	ti.Focus()
 	ti.CharLimit = 500
 
+	names := newNameRegistry()
+	names.add(username)
+
 	return ChatModel{
+		names:        names,
 		messages:     make([]chatMsg, 0, 100),
 		input:        ti,
 		username:     username,
 		onSend:       onSend,
+		onTimer:      onTimer,
 		width:        80,
 		height:       24,
 		scrollOffset: 0,
 	}
 }
 
+// WithHistory returns a copy of the model pre-populated with previously stored messages.
+func (m ChatModel) WithHistory(history []NewChatMsg) ChatModel {
+	for _, msg := range history {
+		m.messages = append(m.messages, chatMsg{
+			ID:        msg.ID,
+			Pending:   msg.Pending,
+			Sender:    msg.Sender,
+			Text:      msg.Text,
+			ExpiresAt: msg.ExpiresAt,
+		})
+		m.names.add(msg.Sender)
+	}
+	m.scrollToBottom()
+	return m
+}
+
+// WithUsername returns a copy of the model for a different local user.
+func (m ChatModel) WithUsername(username string) ChatModel {
+	m.username = username
+	m.names.add(username)
+	return m
+}
+
+// WithReconnectControls returns a copy of the model that calls retryNow and
+// giveUp when the user presses Ctrl+R or Ctrl+G while the connection status
+// allows it.
+func (m ChatModel) WithReconnectControls(retryNow, giveUp func()) ChatModel {
+	m.onRetryNow = retryNow
+	m.onGiveUp = giveUp
+	return m
+}
+
+// WithStats returns a copy of the model whose /stats command shows the
+// lines returned by stats.
+func (m ChatModel) WithStats(stats func() []string) ChatModel {
+	m.stats = stats
+	return m
+}
+
+// WithKnownNames returns a copy of the model that treats the given names,
+// for example from a contact list, as already seen for lookalike detection.
+func (m ChatModel) WithKnownNames(names ...string) ChatModel {
+	for _, name := range names {
+		m.names.add(name)
+	}
+	return m
+}
+
 func (m ChatModel) Init() tea.Cmd {
-	return textinput.Blink
+	return tea.Batch(textinput.Blink, expireTick())
+}
+
+func expireTick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return expireTickMsg(t)
+	})
 }
 
 func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -61,16 +193,27 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch msg.String() {
 		case "ctrl+c":
 			return m, tea.Quit
+		case "ctrl+x":
+			return m.wipe()
+		case "ctrl+r":
+			if m.canRetry && m.onRetryNow != nil {
+				m.canRetry, m.canGiveUp = false, false
+				m.onRetryNow()
+			}
+			return m, nil
+		case "ctrl+g":
+			if m.canGiveUp && m.onGiveUp != nil {
+				m.canGiveUp = false
+				m.onGiveUp()
+			}
+			return m, nil
 		case "up":
 			if m.scrollOffset > 0 {
 				m.scrollOffset--
 			}
 			return m, nil
 		case "down":
-			availableHeight := m.height - 8
-			if availableHeight < 1 {
-				availableHeight = 1
-			}
+			availableHeight := m.messageAreaHeight()
 			maxScroll := len(m.messages) - availableHeight
 			if maxScroll < 0 {
 				maxScroll = 0
@@ -87,17 +230,90 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if text == "/quit" {
 				return m, tea.Quit
 			}
-			m.messages = append(m.messages, chatMsg{Sender: m.username, Text: text})
-			m.input.SetValue("")
-			m.scrollToBottom()
+			if text == "/wipe" {
+				return m.wipe()
+			}
+			if strings.HasPrefix(text, "/search") {
+				m.input.SetValue("")
+				m.search(strings.TrimSpace(strings.TrimPrefix(text, "/search")))
+				m.scrollToBottom()
+				return m, nil
+			}
+			if text == "/stats" {
+				m.input.SetValue("")
+				m.showStats()
+				m.scrollToBottom()
+				return m, nil
+			}
+			if strings.HasPrefix(text, "/timer") {
+				m.input.SetValue("")
+				m.setTimer(strings.TrimSpace(strings.TrimPrefix(text, "/timer")))
+				m.scrollToBottom()
+				return m, nil
+			}
+			entry := chatMsg{Sender: m.username, Text: text}
+			if m.ttl > 0 {
+				entry.ExpiresAt = time.Now().Add(m.ttl)
+			}
 			if m.onSend != nil {
-				m.onSend(text)
+				entry.ID, entry.Pending = m.onSend(text, m.ttl)
 			}
+			m.messages = append(m.messages, entry)
+			m.input.SetValue("")
+			m.scrollToBottom()
 		}
 
 	case NewChatMsg:
-		m.messages = append(m.messages, chatMsg{Sender: msg.Sender, Text: msg.Text})
+		m.messages = append(m.messages, chatMsg{
+			ID:        msg.ID,
+			Pending:   msg.Pending,
+			Sender:    msg.Sender,
+			Text:      msg.Text,
+			ExpiresAt: msg.ExpiresAt,
+			Lookalike: m.names.lookalike(msg.Sender),
+		})
+		m.names.add(msg.Sender)
+		for _, warning := range msg.Warnings {
+			m.messages = append(m.messages, chatMsg{Text: warning, System: true})
+		}
+		m.scrollToBottom()
+
+	case MessageSentMsg:
+		m.setPending(msg.ID, false)
+		return m, nil
+
+	case MessageQueuedMsg:
+		m.setPending(msg.ID, true)
+		return m, nil
+
+	case SystemMsg:
+		m.messages = append(m.messages, chatMsg{Text: msg.Text, System: true})
+		m.scrollToBottom()
+
+	case TimerMsg:
+		m.proposal = &msg
+		m.messages = append(m.messages, chatMsg{
+			Text: fmt.Sprintf("%s %s. Type /timer accept to use this timer too",
+				msg.Sender, describeTimer(msg.TTL)),
+			System: true,
+		})
 		m.scrollToBottom()
+
+	case ConnectionStatusMsg:
+		m.banner = msg.Text
+		m.canRetry = msg.CanRetry
+		m.canGiveUp = msg.CanGiveUp
+		m.scrollToBottom()
+		return m, nil
+
+	case EndpointMsg:
+		m.endpoint = msg.Addr
+		m.fallback = msg.Fallback
+		return m, nil
+
+	case expireTickMsg:
+		m.removeExpired(time.Time(msg))
+		return m, expireTick()
 	}
 
 	var cmd tea.Cmd
@@ -105,11 +321,153 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
-func (m *ChatModel) scrollToBottom() {
+// setPending updates the delivery state of the message with the given ID.
+func (m *ChatModel) setPending(id string, pending bool) {
+	for i := range m.messages {
+		if m.messages[i].ID == id {
+			m.messages[i].Pending = pending
+		}
+	}
+}
+
+// wipe clears all chat state and quits the program. The caller is expected
+// to check Wiped on the final model and destroy local data.
+func (m ChatModel) wipe() (tea.Model, tea.Cmd) {
+	m.messages = nil
+	m.input.Reset()
+	m.username = ""
+	m.scrollOffset = 0
+	m.wiped = true
+	return m, tea.Sequence(tea.ClearScreen, tea.Quit)
+}
+
+// Wiped reports whether the user requested a panic wipe with /wipe or Ctrl+X.
+func (m ChatModel) Wiped() bool {
+	return m.wiped
+}
+
+// setTimer handles the /timer command. The argument is a Go duration such as
+// "10m", "off" to disable disappearing messages, or "accept" to apply the
+// timer last announced by a peer. Accepting is local and not announced.
+func (m *ChatModel) setTimer(arg string) {
+	if arg == "accept" {
+		if m.proposal == nil {
+			m.messages = append(m.messages, chatMsg{Text: "no timer change to accept", System: true})
+			return
+		}
+		m.ttl = m.proposal.TTL
+		m.messages = append(m.messages, chatMsg{
+			Text:   fmt.Sprintf("you accepted the timer of %s and %s", m.proposal.Sender, describeTimer(m.ttl)),
+			System: true,
+		})
+		m.proposal = nil
+		return
+	}
+
+	var ttl time.Duration
+	if arg != "off" {
+		d, err := time.ParseDuration(arg)
+		if err != nil || d < time.Second {
+			m.messages = append(m.messages, chatMsg{
+				Text:   "usage: /timer <duration> (e.g. /timer 10m), /timer off or /timer accept",
+				System: true,
+			})
+			return
+		}
+		ttl = d
+	}
+
+	m.ttl = ttl
+	m.proposal = nil
+	m.messages = append(m.messages, chatMsg{
+		Text:   "you " + describeTimer(ttl),
+		System: true,
+	})
+	if m.onTimer != nil {
+		m.onTimer(ttl)
+	}
+}
+
+func describeTimer(ttl time.Duration) string {
+	if ttl <= 0 {
+		return "turned off disappearing messages"
+	}
+	return fmt.Sprintf("set disappearing messages to %v", ttl)
+}
+
+// search handles the /search command by listing the messages whose sender
+// or text contains the query, ignoring case.
+func (m *ChatModel) search(query string) {
+	if query == "" {
+		m.messages = append(m.messages, chatMsg{Text: "usage: /search <text>", System: true})
+		return
+	}
+
+	q := strings.ToLower(query)
+	var found []chatMsg
+	for _, msg := range m.messages {
+		if msg.System {
+			continue
+		}
+		if strings.Contains(strings.ToLower(msg.Text), q) ||
+			strings.Contains(strings.ToLower(msg.Sender), q) {
+			found = append(found, msg)
+		}
+	}
+
+	m.messages = append(m.messages, chatMsg{
+		Text:   fmt.Sprintf("%d result(s) for %q", len(found), query),
+		System: true,
+	})
+	for _, msg := range found {
+		m.messages = append(m.messages, chatMsg{
+			Text:   fmt.Sprintf("  %s: %s", msg.Sender, msg.Text),
+			System: true,
+		})
+	}
+}
+
+// showStats handles the /stats command.
+func (m *ChatModel) showStats() {
+	if m.stats == nil {
+		m.messages = append(m.messages, chatMsg{Text: "statistics are not available", System: true})
+		return
+	}
+	for _, line := range m.stats() {
+		m.messages = append(m.messages, chatMsg{Text: line, System: true})
+	}
+}
+
+// removeExpired drops every message whose expiry time has passed.
+func (m *ChatModel) removeExpired(now time.Time) {
+	kept := m.messages[:0]
+	for _, msg := range m.messages {
+		if !msg.ExpiresAt.IsZero() && !now.Before(msg.ExpiresAt) {
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	if len(kept) == len(m.messages) {
+		return
+	}
+	m.messages = kept
+	m.scrollToBottom()
+}
+
+// messageAreaHeight returns the number of message lines that fit on screen.
+func (m ChatModel) messageAreaHeight() int {
 	availableHeight := m.height - 8
+	if m.banner != "" {
+		availableHeight--
+	}
 	if availableHeight < 1 {
 		availableHeight = 1
 	}
+	return availableHeight
+}
+
+func (m *ChatModel) scrollToBottom() {
+	availableHeight := m.messageAreaHeight()
 	maxScroll := len(m.messages) - availableHeight
 	if maxScroll < 0 {
 		maxScroll = 0
@@ -120,16 +478,22 @@ func (m *ChatModel) scrollToBottom() {
 func (m ChatModel) View() string {
 	var s strings.Builder
 
-	title := TitleStyle(
-		m.width,
-	).Render(fmt.Sprintf("Username — %s", m.username))
+	header := fmt.Sprintf("Username — %s", m.username)
+	if m.endpoint != "" {
+		header += " · " + m.endpoint
+		if m.fallback {
+			header += " (fallback)"
+		}
+	}
+	title := TitleStyle(m.width).Render(header)
 	s.WriteString(title + "\n")
 
-	availableHeight := m.height - 8
-	if availableHeight < 1 {
-		availableHeight = 1
+	if m.banner != "" {
+		s.WriteString(WarningStyle().Render(m.banner) + "\n")
 	}
 
+	availableHeight := m.messageAreaHeight()
+
 	startIdx := m.scrollOffset
 	endIdx := m.scrollOffset + availableHeight
 	if endIdx > len(m.messages) {
@@ -140,8 +504,21 @@ func (m ChatModel) View() string {
 	messageLines := 0
 	for i := startIdx; i < endIdx; i++ {
 		msg := m.messages[i]
-		sender := SenderStyle().Render(msg.Sender + ":")
-		text := MessageTextStyle().Render(" " + msg.Text)
+		if msg.System {
+			text, _ := Sanitize(msg.Text)
+			messagesContent.WriteString(WarningStyle().Render("⚠ "+text) + "\n")
+			messageLines++
+			continue
+		}
+		sender := SenderStyle().Render(sanitizeForView(msg.Sender) + ":")
+		if msg.Lookalike != "" {
+			lookalike, _ := Sanitize(msg.Lookalike)
+			sender = WarningStyle().Render("[looks like "+lookalike+"] ") + sender
+		}
+		text := MessageTextStyle().Render(" " + sanitizeForView(msg.Text))
+		if msg.Pending {
+			text += HelpStyle().Render(" (pending)")
+		}
 		messagesContent.WriteString(sender + text + "\n")
 		messageLines++
 	}
@@ -154,11 +531,17 @@ func (m ChatModel) View() string {
 		Render(strings.TrimRight(messagesContent.String(), "\n"))
 	s.WriteString(messagesBox + "\n")
 
-	scrollInfo := ""
+	var help []string
 	if len(m.messages) > availableHeight {
-		scrollInfo = "↑↓ to scroll"
+		help = append(help, "↑↓ to scroll")
+	}
+	if m.canRetry && m.onRetryNow != nil {
+		help = append(help, "Ctrl+R retry now")
+	}
+	if m.canGiveUp && m.onGiveUp != nil {
+		help = append(help, "Ctrl+G give up")
 	}
-	s.WriteString(HelpStyle().Render(scrollInfo) + "\n")
+	s.WriteString(HelpStyle().Render(strings.Join(help, " · ")) + "\n")
 
 	inputBox := InputBoxStyle(m.width - 4).Render(m.input.View())
 	s.WriteString(inputBox)
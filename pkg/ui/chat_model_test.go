@@ -0,0 +1,231 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestChatPendingMessages(t *testing.T) {
+	offline := func(text string, ttl time.Duration) (string, bool) {
+		return "id-1", true
+	}
+	var model tea.Model = NewChatModel("me", offline, nil)
+
+	m := model.(ChatModel)
+	m.input.SetValue("hello")
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if view := model.(ChatModel).View(); !strings.Contains(view, "(pending)") {
+		t.Fatal("View() does not mark an undelivered message as pending")
+	}
+
+	model, _ = model.Update(MessageSentMsg{ID: "id-1"})
+	if view := model.(ChatModel).View(); strings.Contains(view, "(pending)") {
+		t.Error("View() still shows the message as pending after delivery")
+	}
+}
+
+func TestChatReconnectControls(t *testing.T) {
+	var retried, gaveUp int
+	var model tea.Model = NewChatModel("me", nil, nil).
+		WithReconnectControls(func() { retried++ }, func() { gaveUp++ })
+
+	ctrlR := tea.KeyMsg{Type: tea.KeyCtrlR}
+	ctrlG := tea.KeyMsg{Type: tea.KeyCtrlG}
+
+	model, _ = model.Update(ctrlR)
+	if retried != 0 {
+		t.Fatal("Ctrl+R retried while connected")
+	}
+
+	model, _ = model.Update(ConnectionStatusMsg{Text: "Reconnecting in 2s", CanRetry: true, CanGiveUp: true})
+	if view := model.(ChatModel).View(); !strings.Contains(view, "Ctrl+G give up") {
+		t.Error("View() does not offer the give up control while waiting")
+	}
+	model, _ = model.Update(ctrlG)
+	model, _ = model.Update(ctrlG)
+	if gaveUp != 1 {
+		t.Errorf("give up called %d times, want 1", gaveUp)
+	}
+
+	model, _ = model.Update(ConnectionStatusMsg{Text: "Offline", CanRetry: true})
+	model, _ = model.Update(ctrlR)
+	if retried != 1 {
+		t.Errorf("retry now called %d times, want 1", retried)
+	}
+}
+
+func TestChatStatsCommand(t *testing.T) {
+	m := NewChatModel("me", nil, nil).WithStats(func() []string {
+		return []string{"connections: 2 established", "send queue: 0"}
+	})
+	m.input.SetValue("/stats")
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	view := model.(ChatModel).View()
+	for _, want := range []string{"connections: 2 established", "send queue: 0"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("View() lacks %q after /stats", want)
+		}
+	}
+}
+
+func TestChatShowsEndpoint(t *testing.T) {
+	var model tea.Model = NewChatModel("me", nil, nil)
+
+	model, _ = model.Update(EndpointMsg{Addr: "[2001:db8::2]:4000", Fallback: true})
+	if view := model.(ChatModel).View(); !strings.Contains(view, "[2001:db8::2]:4000 (fallback)") {
+		t.Error("View() does not show the fallback endpoint")
+	}
+
+	model, _ = model.Update(EndpointMsg{Addr: "chat.example:4000"})
+	view := model.(ChatModel).View()
+	if !strings.Contains(view, "chat.example:4000") || strings.Contains(view, "(fallback)") {
+		t.Error("View() does not show the primary endpoint")
+	}
+}
+
+// enter types text into the chat input and presses Enter.
+func enter(model tea.Model, text string) tea.Model {
+	m := model.(ChatModel)
+	m.input.SetValue(text)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	return model
+}
+
+func TestChatTimerCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		peer      *TimerMsg // announced before the commands
+		commands  []string
+		wantTTL   time.Duration
+		announced []time.Duration
+		wantView  string
+	}{
+		{
+			name:      "set",
+			commands:  []string{"/timer 10m"},
+			wantTTL:   10 * time.Minute,
+			announced: []time.Duration{10 * time.Minute},
+			wantView:  "you set disappearing messages to 10m0s",
+		},
+		{
+			name:      "off",
+			commands:  []string{"/timer 1h", "/timer off"},
+			announced: []time.Duration{time.Hour, 0},
+			wantView:  "you turned off disappearing messages",
+		},
+		{
+			name:     "invalid duration",
+			commands: []string{"/timer 10"},
+			wantView: "usage: /timer",
+		},
+		{
+			name:     "below one second",
+			commands: []string{"/timer 500ms"},
+			wantView: "usage: /timer",
+		},
+		{
+			name:     "peer change needs confirmation",
+			peer:     &TimerMsg{Sender: "mallory", TTL: time.Second},
+			wantView: "Type /timer accept",
+		},
+		{
+			name:     "accept peer change",
+			peer:     &TimerMsg{Sender: "bob", TTL: 5 * time.Minute},
+			commands: []string{"/timer accept"},
+			wantTTL:  5 * time.Minute,
+			wantView: "you accepted the timer of bob",
+		},
+		{
+			name:      "own change replaces peer proposal",
+			peer:      &TimerMsg{Sender: "bob", TTL: 5 * time.Minute},
+			commands:  []string{"/timer 1m", "/timer accept"},
+			wantTTL:   time.Minute,
+			announced: []time.Duration{time.Minute},
+			wantView:  "no timer change to accept",
+		},
+		{
+			name:     "accept without proposal",
+			commands: []string{"/timer accept"},
+			wantView: "no timer change to accept",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var announced []time.Duration
+			var model tea.Model = NewChatModel("me", nil, func(ttl time.Duration) {
+				announced = append(announced, ttl)
+			})
+			if tt.peer != nil {
+				model, _ = model.Update(*tt.peer)
+			}
+			for _, cmd := range tt.commands {
+				model = enter(model, cmd)
+			}
+
+			m := model.(ChatModel)
+			if m.ttl != tt.wantTTL {
+				t.Errorf("ttl = %v, want %v", m.ttl, tt.wantTTL)
+			}
+			if len(announced) != len(tt.announced) {
+				t.Fatalf("announced %v, want %v", announced, tt.announced)
+			}
+			for i := range announced {
+				if announced[i] != tt.announced[i] {
+					t.Errorf("announced %v, want %v", announced, tt.announced)
+				}
+			}
+			if view := m.View(); !strings.Contains(view, tt.wantView) {
+				t.Errorf("View() lacks %q:\n%s", tt.wantView, view)
+			}
+		})
+	}
+}
+
+func TestChatMessagesExpire(t *testing.T) {
+	var sentTTL time.Duration
+	send := func(text string, ttl time.Duration) (string, bool) {
+		sentTTL = ttl
+		return "id-" + text, false
+	}
+	var model tea.Model = NewChatModel("me", send, nil)
+	model = enter(model, "/timer 1m")
+	before := time.Now()
+	model = enter(model, "secret")
+	if sentTTL != time.Minute {
+		t.Errorf("message sent with ttl %v, want %v", sentTTL, time.Minute)
+	}
+	model = enter(model, "/timer off")
+	model = enter(model, "kept")
+	model, _ = model.Update(NewChatMsg{Sender: "bob", Text: "incoming", ExpiresAt: before.Add(30 * time.Second)})
+
+	tests := []struct {
+		at       time.Time
+		wantGone []string
+		wantKept []string
+	}{
+		{at: before, wantKept: []string{"secret", "incoming", "kept"}},
+		{at: before.Add(30 * time.Second), wantGone: []string{"incoming"}, wantKept: []string{"secret", "kept"}},
+		{at: before.Add(2 * time.Minute), wantGone: []string{"secret", "incoming"}, wantKept: []string{"kept"}},
+	}
+	for _, tt := range tests {
+		model, _ = model.Update(expireTickMsg(tt.at))
+		texts := map[string]bool{}
+		for _, msg := range model.(ChatModel).messages {
+			texts[msg.Text] = true
+		}
+		for _, text := range tt.wantGone {
+			if texts[text] {
+				t.Errorf("at %v: %q has not expired", tt.at.Sub(before), text)
+			}
+		}
+		for _, text := range tt.wantKept {
+			if !texts[text] {
+				t.Errorf("at %v: %q expired too early", tt.at.Sub(before), text)
+			}
+		}
+	}
+}
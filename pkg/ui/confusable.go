@@ -0,0 +1,109 @@
+package ui
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables maps characters that render like a Latin letter or digit to
+// that letter. It is a subset of the Unicode TR39 confusables table covering
+// the scripts most often used for username spoofing.
+var confusables = map[rune]rune{
+	// Latin and digits
+	'I': 'l', '1': 'l', '|': 'l', '0': 'o', 'ı': 'i', 'ɑ': 'a', 'ɡ': 'g',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'о': 'o', 'р': 'p', 'с': 'c',
+	'у': 'y', 'х': 'x', 'і': 'i', 'ї': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd',
+	'һ': 'h', 'ӏ': 'l', 'ԛ': 'q', 'ԝ': 'w', 'ү': 'y', 'к': 'k', 'м': 'm',
+	'н': 'h', 'т': 't', 'ь': 'b',
+	'А': 'a', 'В': 'b', 'Е': 'e', 'К': 'k', 'М': 'm', 'Н': 'h', 'О': 'o',
+	'Р': 'p', 'С': 'c', 'Т': 't', 'Х': 'x', 'У': 'y', 'І': 'l', 'Ј': 'j',
+	'Ѕ': 's', 'Ԛ': 'q', 'Ԝ': 'w', 'Ӏ': 'l',
+	// Greek
+	'α': 'a', 'ο': 'o', 'ν': 'v', 'ρ': 'p', 'ι': 'i', 'κ': 'k', 'τ': 't',
+	'υ': 'u', 'ϲ': 'c', 'ϳ': 'j',
+	'Α': 'a', 'Β': 'b', 'Ε': 'e', 'Ζ': 'z', 'Η': 'h', 'Ι': 'l', 'Κ': 'k',
+	'Μ': 'm', 'Ν': 'n', 'Ο': 'o', 'Ρ': 'p', 'Τ': 't', 'Υ': 'y', 'Χ': 'x',
+}
+
+// multiConfusables are letter sequences that render like a single letter.
+var multiConfusables = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// Skeleton returns the confusable skeleton of a username: the NFKC normal
+// form with invisible characters removed, look-alike characters mapped to a
+// common prototype and case folded. Two names with the same skeleton look the
+// same, or nearly the same, on screen.
+func Skeleton(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKC.String(name) {
+		if isInvisible(r) || unicode.IsControl(r) {
+			continue
+		}
+		if proto, ok := confusables[r]; ok {
+			r = proto
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return multiConfusables.Replace(b.String())
+}
+
+// HasConfusableChars reports whether name contains characters that imitate
+// other letters, so that it could be mistaken for a different name. Plain
+// ASCII digits and a leading capital I are not reported, since they are
+// common in legitimate names.
+func HasConfusableChars(name string) bool {
+	if norm.NFKC.String(name) != name {
+		return true
+	}
+	prev := rune(0)
+	for _, r := range name {
+		switch {
+		case isInvisible(r):
+			return true
+		case r == 'I':
+			if unicode.IsLower(prev) {
+				return true
+			}
+		case r > unicode.MaxASCII:
+			if _, ok := confusables[r]; ok {
+				return true
+			}
+		}
+		prev = r
+	}
+	return false
+}
+
+// nameRegistry remembers the usernames seen in a session and finds
+// previously seen names that a new one imitates.
+type nameRegistry struct {
+	names map[string]struct{}
+}
+
+func newNameRegistry() nameRegistry {
+	return nameRegistry{names: make(map[string]struct{})}
+}
+
+// add records name as known.
+func (r nameRegistry) add(name string) {
+	if name != "" {
+		r.names[name] = struct{}{}
+	}
+}
+
+// lookalike returns a known name that differs from name but has the same
+// skeleton, or "" if there is none. If several match, the first in sorted
+// order is returned so the warning does not change between renders.
+func (r nameRegistry) lookalike(name string) string {
+	skeleton := Skeleton(name)
+	for _, known := range slices.Sorted(maps.Keys(r.names)) {
+		if known != name && Skeleton(known) == skeleton {
+			return known
+		}
+	}
+	return ""
+}
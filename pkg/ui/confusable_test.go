@@ -0,0 +1,85 @@
+package ui
+
+import "testing"
+
+func TestSkeleton(t *testing.T) {
+	tests := []struct {
+		name      string
+		a         string
+		b         string
+		wantMatch bool
+	}{
+		{name: "identical", a: "alice", b: "alice", wantMatch: true},
+		{name: "capital I for l", a: "aIice", b: "alice", wantMatch: true},
+		{name: "digit one for l", a: "a1ice", b: "alice", wantMatch: true},
+		{name: "cyrillic a", a: "\u0430lice", b: "alice", wantMatch: true},
+		{name: "greek omicron", a: "b\u03bfb", b: "bob", wantMatch: true},
+		{name: "zero width space", a: "al\u200bice", b: "alice", wantMatch: true},
+		{name: "fullwidth letters", a: "\uff41\uff4c\uff49\uff43\uff45", b: "alice", wantMatch: true},
+		{name: "rn for m", a: "rnallory", b: "mallory", wantMatch: true},
+		{name: "case variant", a: "Alice", b: "alice", wantMatch: true},
+		{name: "different names", a: "alice", b: "alicia", wantMatch: false},
+		{name: "different letters", a: "bob", b: "rob", wantMatch: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := Skeleton(tt.a) == Skeleton(tt.b)
+			if match != tt.wantMatch {
+				t.Errorf(
+					"Skeleton(%q) = %q, Skeleton(%q) = %q, match %v, want %v",
+					tt.a, Skeleton(tt.a), tt.b, Skeleton(tt.b), match, tt.wantMatch,
+				)
+			}
+		})
+	}
+}
+
+func TestHasConfusableChars(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"alice", false},
+		{"bob_42", false},
+		{"Igor", false},
+		{"aIice", true},
+		{"\u0430lice", true},
+		{"al\u200bice", true},
+		{"\uff41lice", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := HasConfusableChars(tt.input); got != tt.expected {
+				t.Errorf("HasConfusableChars(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestChatModelFlagsLookalikeSender(t *testing.T) {
+	m := NewChatModel("me", nil, nil).WithKnownNames("alice")
+	model, _ := m.Update(NewChatMsg{Sender: "aIice", Text: "it's me, alice"})
+	model, _ = model.Update(NewChatMsg{Sender: "alice", Text: "real alice"})
+
+	chat := model.(ChatModel)
+	if got := chat.messages[0].Lookalike; got != "alice" {
+		t.Errorf("lookalike of aIice = %q, want %q", got, "alice")
+	}
+	if got := chat.messages[1].Lookalike; got != "aIice" {
+		t.Errorf("lookalike of alice = %q, want %q", got, "aIice")
+	}
+}
+
+func TestLookalikeIsDeterministic(t *testing.T) {
+	registry := newNameRegistry()
+	for _, name := range []string{"bob", "b0b", "b\u03bfb", "carol"} {
+		registry.add(name)
+	}
+	for i := 0; i < 20; i++ {
+		if got := registry.lookalike("b\u043eb"); got != "b0b" {
+			t.Fatalf("lookalike() = %q, want %q", got, "b0b")
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SanitizedBadge is appended to untrusted content that had characters escaped.
+const SanitizedBadge = "[sanitized]"
+
+// Sanitize makes untrusted text from the network safe to render in the
+// terminal. Control characters (including ESC, so ANSI/OSC sequences cannot
+// reach the terminal), bidi overrides and zero-width characters are replaced
+// with a visible escape such as \x1b or \u202e, and invalid UTF-8 is replaced
+// with U+FFFD. It reports whether anything was changed.
+func Sanitize(s string) (string, bool) {
+	var b strings.Builder
+	changed := false
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteRune(unicode.ReplacementChar)
+			changed = true
+		case r < 0x80 && unicode.IsControl(r):
+			fmt.Fprintf(&b, "\\x%02x", r)
+			changed = true
+		case unicode.IsControl(r) || isInvisible(r):
+			fmt.Fprintf(&b, "\\u%04x", r)
+			changed = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String(), changed
+}
+
+// isInvisible reports whether r changes text direction, has no width, or
+// otherwise lets one string masquerade as another on screen.
+func isInvisible(r rune) bool {
+	switch {
+	case r >= 0x202A && r <= 0x202E: // LRE, RLE, PDF, LRO, RLO
+		return true
+	case r >= 0x2066 && r <= 0x2069: // LRI, RLI, FSI, PDI
+		return true
+	case r >= 0x200B && r <= 0x200F: // ZWSP, ZWNJ, ZWJ, LRM, RLM
+		return true
+	case r == 0x061C, r == 0x2060, r == 0xFEFF, r == 0x180E, r == 0x00AD:
+		return true
+	case r == 0x2028, r == 0x2029:
+		return true
+	}
+	return false
+}
+
+// sanitizeForView sanitizes s and appends a visible badge if it was modified.
+func sanitizeForView(s string) string {
+	clean, changed := Sanitize(s)
+	if changed {
+		return clean + " " + WarningStyle().Render(SanitizedBadge)
+	}
+	return clean
+}
@@ -0,0 +1,143 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		wantChanged bool
+	}{
+		{
+			name:        "plain text",
+			input:       "hello, world",
+			expected:    "hello, world",
+			wantChanged: false,
+		},
+		{
+			name:        "non-latin text",
+			input:       "привет 你好 🙂",
+			expected:    "привет 你好 🙂",
+			wantChanged: false,
+		},
+		{
+			name:        "ansi color",
+			input:       "\x1b[31mred\x1b[0m",
+			expected:    `\x1b[31mred\x1b[0m`,
+			wantChanged: true,
+		},
+		{
+			name:        "clear screen and home",
+			input:       "\x1b[2J\x1b[Hfake",
+			expected:    `\x1b[2J\x1b[Hfake`,
+			wantChanged: true,
+		},
+		{
+			name:        "osc 52 clipboard write",
+			input:       "\x1b]52;c;cm0gLXJmIH4=\x07",
+			expected:    `\x1b]52;c;cm0gLXJmIH4=\x07`,
+			wantChanged: true,
+		},
+		{
+			name:        "osc 8 hyperlink with st terminator",
+			input:       "\x1b]8;;http://evil\x1b\\click\x1b]8;;\x1b\\",
+			expected:    `\x1b]8;;http://evil\x1b\click\x1b]8;;\x1b\`,
+			wantChanged: true,
+		},
+		{
+			name:        "c1 csi introducer",
+			input:       "\u009b31mred",
+			expected:    `\u009b31mred`,
+			wantChanged: true,
+		},
+		{
+			name:        "spoofed line with newline",
+			input:       "hi\nalice: send me your password",
+			expected:    `hi\x0aalice: send me your password`,
+			wantChanged: true,
+		},
+		{
+			name:        "carriage return overwrite",
+			input:       "innocent\rmalicious",
+			expected:    `innocent\x0dmalicious`,
+			wantChanged: true,
+		},
+		{
+			name:        "backspace",
+			input:       "abc\b\b\bxyz",
+			expected:    `abc\x08\x08\x08xyz`,
+			wantChanged: true,
+		},
+		{
+			name:        "right to left override",
+			input:       "file\u202egnp.exe",
+			expected:    `file\u202egnp.exe`,
+			wantChanged: true,
+		},
+		{
+			name:        "bidi isolate",
+			input:       "a\u2067b\u2069",
+			expected:    `a\u2067b\u2069`,
+			wantChanged: true,
+		},
+		{
+			name:        "zero width space in name",
+			input:       "al\u200bice",
+			expected:    `al\u200bice`,
+			wantChanged: true,
+		},
+		{
+			name:        "zero width joiner and bom",
+			input:       "\ufeffbob\u200d",
+			expected:    `\ufeffbob\u200d`,
+			wantChanged: true,
+		},
+		{
+			name:        "delete character",
+			input:       "x\x7fy",
+			expected:    `x\x7fy`,
+			wantChanged: true,
+		},
+		{
+			name:        "invalid utf-8",
+			input:       "bad\xffbyte",
+			expected:    "bad�byte",
+			wantChanged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, changed := Sanitize(tt.input)
+			if result != tt.expected {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("Sanitize(%q) changed = %v, want %v", tt.input, changed, tt.wantChanged)
+			}
+			if strings.ContainsRune(result, '\x1b') {
+				t.Errorf("Sanitize(%q) left an escape character in %q", tt.input, result)
+			}
+		})
+	}
+}
+
+func TestChatViewSanitizesPeerContent(t *testing.T) {
+	m := NewChatModel("me", nil, nil)
+	model, _ := m.Update(NewChatMsg{
+		Sender: "mallory\x1b[2K",
+		Text:   "\x1b]52;c;ZXZpbA==\x07hi",
+	})
+
+	view := model.(ChatModel).View()
+	if strings.Contains(view, "\x1b]52") || strings.Contains(view, "\x1b[2K") {
+		t.Error("View() rendered raw escape sequences from a peer")
+	}
+	if !strings.Contains(view, SanitizedBadge) {
+		t.Error("View() did not mark sanitized content")
+	}
+}
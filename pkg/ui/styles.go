@@ -1,6 +1,12 @@
 package ui
 
-import "github.com/charmbracelet/lipgloss"
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
 
 var (
 	Nord0 = lipgloss.Color("#2E3440")
@@ -30,18 +36,73 @@ var (
 	Nord15 = lipgloss.Color("#B48EAD")
 )
 
+// Colors by role. The style functions use these, and SetTheme replaces them.
 var (
-	ColorPrimary      = Nord9
-	ColorPrimaryLight = Nord8
-	ColorWhite        = Nord6
-	ColorGray         = Nord4
-	ColorGrayDark     = Nord3
-	ColorError        = Nord11
-	ColorText         = Nord6
-	ColorBackground   = Nord0
-	ColorSuccess      = Nord14
+	ColorPrimary      lipgloss.TerminalColor = Nord9
+	ColorPrimaryLight lipgloss.TerminalColor = Nord8
+	ColorTitle        lipgloss.TerminalColor = Nord10
+	ColorWhite        lipgloss.TerminalColor = Nord6
+	ColorGray         lipgloss.TerminalColor = Nord4
+	ColorGrayDark     lipgloss.TerminalColor = Nord3
+	ColorError        lipgloss.TerminalColor = Nord11
+	ColorText         lipgloss.TerminalColor = Nord6
+	ColorBackground   lipgloss.TerminalColor = Nord0
+	ColorSuccess      lipgloss.TerminalColor = Nord14
+	ColorWarning      lipgloss.TerminalColor = Nord13
 )
 
+// palette assigns a color to every role.
+type palette struct {
+	primary, primaryLight, title, white, gray, grayDark lipgloss.TerminalColor
+	err, text, background, success, warning             lipgloss.TerminalColor
+}
+
+var themes = map[string]palette{
+	"nord": {
+		primary: Nord9, primaryLight: Nord8, title: Nord10, white: Nord6, gray: Nord4, grayDark: Nord3,
+		err: Nord11, text: Nord6, background: Nord0, success: Nord14, warning: Nord13,
+	},
+	// light suits terminals with a light background.
+	"light": {
+		primary: Nord10, primaryLight: Nord10, title: Nord10, white: Nord6, gray: Nord3, grayDark: Nord3,
+		err: Nord11, text: Nord0, background: Nord6, success: Nord14, warning: Nord12,
+	},
+	// mono uses the terminal's own colors only.
+	"mono": {
+		primary: lipgloss.NoColor{}, primaryLight: lipgloss.NoColor{}, title: lipgloss.NoColor{},
+		white: lipgloss.NoColor{}, gray: lipgloss.NoColor{}, grayDark: lipgloss.NoColor{},
+		err: lipgloss.NoColor{}, text: lipgloss.NoColor{}, background: lipgloss.NoColor{},
+		success: lipgloss.NoColor{}, warning: lipgloss.NoColor{},
+	},
+}
+
+// Themes returns the names accepted by SetTheme.
+func Themes() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// SetTheme switches the colors of all views. An empty name selects the
+// default "nord" theme. Call it before starting a program.
+func SetTheme(name string) error {
+	if name == "" {
+		name = "nord"
+	}
+	p, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %q (available: %s)", name, strings.Join(Themes(), ", "))
+	}
+	ColorPrimary, ColorPrimaryLight, ColorTitle = p.primary, p.primaryLight, p.title
+	ColorWhite, ColorGray, ColorGrayDark = p.white, p.gray, p.grayDark
+	ColorError, ColorText, ColorBackground = p.err, p.text, p.background
+	ColorSuccess, ColorWarning = p.success, p.warning
+	return nil
+}
+
 func AppBackgroundStyle(width, height int) lipgloss.Style {
 	return lipgloss.NewStyle().
 		Background(ColorBackground).
@@ -52,8 +113,8 @@ func AppBackgroundStyle(width, height int) lipgloss.Style {
 
 func TitleStyle(width int) lipgloss.Style {
 	style := lipgloss.NewStyle().
-		Foreground(Nord6).
-		Background(Nord10).
+		Foreground(ColorWhite).
+		Background(ColorTitle).
 		Padding(0, 1).
 		Bold(true)
 
@@ -66,7 +127,7 @@ func TitleStyle(width int) lipgloss.Style {
 
 func LabelStyle() lipgloss.Style {
 	return lipgloss.NewStyle().
-		Foreground(Nord4).
+		Foreground(ColorGray).
 		Bold(true)
 }
 
@@ -76,16 +137,22 @@ func ErrorStyle() lipgloss.Style {
 		Bold(true)
 }
 
+func WarningStyle() lipgloss.Style {
+	return lipgloss.NewStyle().
+		Foreground(ColorWarning).
+		Bold(true)
+}
+
 func HelpStyle() lipgloss.Style {
 	return lipgloss.NewStyle().
-		Foreground(Nord3).
+		Foreground(ColorGrayDark).
 		Italic(true)
 }
 
 func MessageBoxStyle(width, height int) lipgloss.Style {
 	return lipgloss.NewStyle().
 		Border(lipgloss.RoundedBorder()).
-		BorderForeground(Nord8).
+		BorderForeground(ColorPrimaryLight).
 		Width(width).
 		Height(height).
 		Padding(0, 1)
@@ -94,23 +161,23 @@ func MessageBoxStyle(width, height int) lipgloss.Style {
 func InputBoxStyle(width int) lipgloss.Style {
 	return lipgloss.NewStyle().
 		Border(lipgloss.RoundedBorder()).
-		BorderForeground(Nord9).
+		BorderForeground(ColorPrimary).
 		Width(width).
 		Padding(0, 1)
 }
 
 func SenderStyle() lipgloss.Style {
 	return lipgloss.NewStyle().
-		Foreground(Nord8).
+		Foreground(ColorPrimaryLight).
 		Bold(true)
 }
 
 func MessageTextStyle() lipgloss.Style {
 	return lipgloss.NewStyle().
-		Foreground(Nord6)
+		Foreground(ColorText)
 }
 
 func InputTextStyle() lipgloss.Style {
 	return lipgloss.NewStyle().
-		Foreground(Nord6)
+		Foreground(ColorText)
 }